@@ -0,0 +1,169 @@
+// Package accesslog logs each request dispatched by an r2 Router through
+// log/slog, as structured records or in the Common and Combined Log Formats.
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aver-d/r2"
+)
+
+type Format int
+
+const (
+	// Structured logs a record with the request's details as attributes.
+	Structured Format = iota
+	// Common logs a line in the Common Log Format as the message.
+	Common
+	// Combined is Common followed by the referer and user agent.
+	Combined
+)
+
+type Logger struct {
+	Logger *slog.Logger
+	Format Format
+	// Sample, if between 0 and 1, is the fraction of requests logged; 0
+	// logs every request. Server errors and panics are logged regardless.
+	Sample float64
+}
+
+// New logs to w: as JSON for Structured, otherwise one line per request.
+func New(w io.Writer, f Format) *Logger {
+	var h slog.Handler
+	if f == Structured {
+		h = slog.NewJSONHandler(w, nil)
+	} else {
+		h = &lineHandler{w: w}
+	}
+	return &Logger{Logger: slog.New(h), Format: f, Sample: 1}
+}
+
+// Middleware logs the requests passing through it.
+func (l *Logger) Middleware(next r2.Handler) r2.Handler {
+	return func(env *r2.Env) {
+		start := time.Now()
+		defer func() {
+			status := env.Status()
+			// PanicHandler runs later, and is expected to answer 500
+			v := recover()
+			if status == 0 {
+				status = http.StatusOK
+				if v != nil {
+					status = http.StatusInternalServerError
+				}
+			}
+			sampled := l.Sample <= 0 || l.Sample >= 1 || rand.Float64() < l.Sample
+			if sampled || status >= 500 || v != nil {
+				l.log(env, start, status, v != nil)
+			}
+			if v != nil {
+				panic(v)
+			}
+		}()
+		next(env)
+	}
+}
+
+func (l *Logger) log(env *r2.Env, start time.Time, status int, panicked bool) {
+	level := slog.LevelInfo
+	if status >= 500 || panicked {
+		level = slog.LevelError
+	}
+	ctx := env.R.Context()
+	if !l.Logger.Enabled(ctx, level) {
+		return
+	}
+	if l.Format != Structured {
+		l.Logger.Log(ctx, level, l.line(env, start, status))
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", env.R.Method),
+		slog.String("route", env.Route.Pattern),
+		slog.String("path", env.R.URL.Path),
+	}
+	if len(env.Path) > 0 {
+		params := make([]interface{}, len(env.Path))
+		for i, v := range env.Path {
+			params[i] = slog.String(v.Name, v.Value)
+		}
+		attrs = append(attrs, slog.Group("params", params...))
+	}
+	attrs = append(attrs,
+		slog.Int("status", status),
+		slog.Int64("bytes", env.Written()),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("remote", env.R.RemoteAddr),
+	)
+	if panicked {
+		attrs = append(attrs, slog.Bool("panic", true))
+	}
+	if env.Principal != nil {
+		attrs = append(attrs, slog.String("user", env.Principal.Name))
+	}
+	if env.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", env.RequestID))
+	}
+	l.Logger.LogAttrs(ctx, level, "request", attrs...)
+}
+
+// line formats a request in the Common or Combined Log Format.
+func (l *Logger) line(env *r2.Env, start time.Time, status int) string {
+	req := env.R
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	user := "-"
+	if env.Principal != nil && env.Principal.Name != "" {
+		user = env.Principal.Name
+	} else if name, _, ok := req.BasicAuth(); ok && name != "" {
+		user = name
+	}
+	size := "-"
+	if n := env.Written(); n > 0 {
+		size = fmt.Sprint(n)
+	}
+	s := fmt.Sprintf(`%v - %v [%v] "%v %v %v" %v %v`,
+		host, user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		req.Method, req.RequestURI, req.Proto, status, size)
+	if l.Format == Combined {
+		s += fmt.Sprintf(` %q %q`, field(req.Referer()), field(req.UserAgent()))
+	}
+	return s
+}
+
+func field(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// lineHandler writes the message of each record on its own line.
+type lineHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (h *lineHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *lineHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, strings.TrimRight(r.Message, "\n")+"\n")
+	return err
+}
+
+func (h *lineHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *lineHandler) WithGroup(string) slog.Handler      { return h }
@@ -0,0 +1,101 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aver-d/r2"
+)
+
+func serve(l *Logger, path string) {
+	r := r2.NewRouter("")
+	r.Use(r2.RequestID(nil), l.Middleware)
+	r.Get("/repos/:owner/:repo", func(e *r2.Env) { e.Text(200, "hello") })
+	r.Get("/fail", func(e *r2.Env) { e.Error(500, nil) })
+	r.Get("/boom", func(e *r2.Env) { panic("boom") })
+	r.PanicHandler = func(e *r2.Env, v interface{}) { e.Error(500, nil) }
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("X-Request-ID", "abc")
+	req.Header.Set("User-Agent", "test")
+	req.SetBasicAuth("ann", "secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestStructured(t *testing.T) {
+	var b bytes.Buffer
+	serve(New(&b, Structured), "/repos/ann/r2")
+	var rec map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &rec); err != nil {
+		t.Fatal(err, b.String())
+	}
+	for key, want := range map[string]interface{}{
+		"msg": "request", "method": "GET", "route": "/repos/:owner/:repo", "path": "/repos/ann/r2",
+		"status": 200.0, "bytes": 5.0, "remote": "192.0.2.1:1234", "request_id": "abc",
+	} {
+		if rec[key] != want {
+			t.Errorf("%v expected %v, got %v", key, want, rec[key])
+		}
+	}
+	if params, _ := rec["params"].(map[string]interface{}); params["owner"] != "ann" || params["repo"] != "r2" {
+		t.Errorf("unexpected params %v", rec["params"])
+	}
+	if _, ok := rec["latency"]; !ok {
+		t.Error("missing latency")
+	}
+}
+
+func TestLogFormats(t *testing.T) {
+	date := `\[\d\d/\w{3}/\d{4}:\d\d:\d\d:\d\d [+-]\d{4}\]`
+	for f, want := range map[Format]string{
+		Common:   `^192.0.2.1 - ann ` + date + ` "GET /repos/ann/r2 HTTP/1.1" 200 5\n$`,
+		Combined: `^192.0.2.1 - ann ` + date + ` "GET /repos/ann/r2 HTTP/1.1" 200 5 "-" "test"\n$`,
+	} {
+		var b bytes.Buffer
+		serve(New(&b, f), "/repos/ann/r2")
+		if !regexp.MustCompile(want).MatchString(b.String()) {
+			t.Errorf("%q doesn't match %v", b.String(), want)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, Common)
+	l.Sample = math.SmallestNonzeroFloat64
+	serve(l, "/repos/ann/r2")
+	if b.Len() != 0 {
+		t.Errorf("unexpected log %q", b.String())
+	}
+	serve(l, "/fail")
+	if !strings.Contains(b.String(), `"GET /fail HTTP/1.1" 500`) {
+		t.Errorf("server error not logged: %q", b.String())
+	}
+}
+
+func TestZeroSample(t *testing.T) {
+	var b bytes.Buffer
+	l := &Logger{Logger: New(&b, Common).Logger, Format: Common}
+	serve(l, "/repos/ann/r2")
+	if !strings.Contains(b.String(), `"GET /repos/ann/r2 HTTP/1.1" 200`) {
+		t.Errorf("request not logged: %q", b.String())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, Structured)
+	l.Sample = math.SmallestNonzeroFloat64
+	serve(l, "/boom")
+	var rec map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &rec); err != nil {
+		t.Fatal(err, b.String())
+	}
+	if rec["status"] != 500.0 || rec["level"] != "ERROR" || rec["panic"] != true {
+		t.Errorf("unexpected record %v", rec)
+	}
+}
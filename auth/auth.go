@@ -0,0 +1,213 @@
+// Package auth authenticates requests to an r2 Router with HTTP Basic,
+// Bearer tokens or API keys, setting Env.Principal. Its middleware can be
+// applied to a router with Use, to a group with Group.Use, or to a route
+// with r2.With.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aver-d/r2"
+)
+
+var (
+	ErrMissing = errors.New("missing credentials")
+	ErrInvalid = errors.New("invalid credentials")
+)
+
+// rejection reports a credential a Lookup refused as ErrInvalid, so that
+// clients learn nothing of why, while keeping the cause for ErrorHandler
+// to log: errors.Is matches both.
+type rejection struct {
+	cause error
+}
+
+func (r rejection) Error() string   { return ErrInvalid.Error() }
+func (r rejection) Unwrap() []error { return []error{ErrInvalid, r.cause} }
+
+// Lookup returns the principal a token or key belongs to, or an error if
+// it isn't valid.
+type Lookup func(credential string) (*r2.Principal, error)
+
+// Basic authenticates with HTTP Basic, accepting users that check allows.
+func Basic(realm string, check func(user, password string) bool) r2.Middleware {
+	challenge := fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm)
+	return func(next r2.Handler) r2.Handler {
+		return func(env *r2.Env) {
+			user, password, ok := env.R.BasicAuth()
+			if !ok {
+				unauthorized(env, challenge, ErrMissing)
+				return
+			}
+			if !check(user, password) {
+				unauthorized(env, challenge, ErrInvalid)
+				return
+			}
+			env.Principal = &r2.Principal{Name: user, Scheme: "Basic"}
+			next(env)
+		}
+	}
+}
+
+// Users returns a check for Basic accepting the given users and passwords,
+// comparing in constant time.
+func Users(users map[string]string) func(user, password string) bool {
+	hashes := make(map[string][sha256.Size]byte, len(users))
+	for user, password := range users {
+		hashes[user] = sha256.Sum256([]byte(password))
+	}
+	return func(user, password string) bool {
+		// compare even for unknown users, so that timing doesn't tell them apart
+		want, found := hashes[user]
+		got := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(want[:], got[:]) == 1 && found
+	}
+}
+
+// Bearer authenticates with bearer tokens, as sent in the header
+// "Authorization: Bearer <token>", verified by verify.
+func Bearer(realm string, verify Lookup) r2.Middleware {
+	challenge := fmt.Sprintf("Bearer realm=%q", realm)
+	return func(next r2.Handler) r2.Handler {
+		return func(env *r2.Env) {
+			scheme, token, _ := strings.Cut(env.R.Header.Get("Authorization"), " ")
+			token = strings.TrimSpace(token)
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				unauthorized(env, challenge, ErrMissing)
+				return
+			}
+			p, err := verify(token)
+			if err != nil {
+				unauthorized(env, challenge+`, error="invalid_token"`, rejection{err})
+				return
+			}
+			set(env, p, "Bearer")
+			next(env)
+		}
+	}
+}
+
+// APIKey authenticates with a key sent in the named header or, failing
+// that, query parameter. Either name may be empty.
+func APIKey(header, query string, lookup Lookup) r2.Middleware {
+	challenge := `APIKey realm="api"`
+	if header != "" {
+		challenge += fmt.Sprintf(", header=%q", header)
+	}
+	if query != "" {
+		challenge += fmt.Sprintf(", query=%q", query)
+	}
+	return func(next r2.Handler) r2.Handler {
+		return func(env *r2.Env) {
+			var key string
+			if header != "" {
+				key = env.R.Header.Get(header)
+			}
+			if key == "" && query != "" {
+				key = env.Query().Get(query)
+			}
+			if key == "" {
+				unauthorized(env, challenge, ErrMissing)
+				return
+			}
+			p, err := lookup(key)
+			if err != nil {
+				unauthorized(env, challenge, rejection{err})
+				return
+			}
+			set(env, p, "APIKey")
+			next(env)
+		}
+	}
+}
+
+// Keys returns a Lookup for a fixed set of keys, comparing in constant time.
+func Keys(keys map[string]*r2.Principal) Lookup {
+	type entry struct {
+		hash      [sha256.Size]byte
+		principal *r2.Principal
+	}
+	entries := make([]entry, 0, len(keys))
+	for key, p := range keys {
+		entries = append(entries, entry{sha256.Sum256([]byte(key)), p})
+	}
+	return func(key string) (*r2.Principal, error) {
+		hash := sha256.Sum256([]byte(key))
+		var found *r2.Principal
+		// check every key, so that timing doesn't tell which matched
+		for _, e := range entries {
+			if subtle.ConstantTimeCompare(e.hash[:], hash[:]) == 1 {
+				found = e.principal
+			}
+		}
+		if found == nil {
+			return nil, ErrInvalid
+		}
+		return found, nil
+	}
+}
+
+// Require answers 403 Forbidden unless the principal has all the scopes.
+func Require(scopes ...string) r2.Middleware {
+	return func(next r2.Handler) r2.Handler {
+		return func(env *r2.Env) {
+			if permitted(env, scopes) {
+				next(env)
+			}
+		}
+	}
+}
+
+// MetaScopes is the route metadata listing the scopes a route requires,
+// as a []string or a space-separated string.
+const MetaScopes = "scopes"
+
+// RouteScopes answers 403 Forbidden unless the principal has the scopes
+// required in the route's metadata.
+func RouteScopes(next r2.Handler) r2.Handler {
+	return func(env *r2.Env) {
+		var scopes []string
+		switch v := env.Meta(MetaScopes).(type) {
+		case []string:
+			scopes = v
+		case string:
+			scopes = strings.Fields(v)
+		}
+		if permitted(env, scopes) {
+			next(env)
+		}
+	}
+}
+
+// permitted answers 403 and returns false if the principal lacks a scope.
+func permitted(env *r2.Env, scopes []string) bool {
+	for _, scope := range scopes {
+		if !env.Principal.HasScope(scope) {
+			env.Error(http.StatusForbidden, fmt.Errorf("missing scope %v", scope))
+			return false
+		}
+	}
+	return true
+}
+
+func set(env *r2.Env, p *r2.Principal, scheme string) {
+	if p == nil {
+		p = &r2.Principal{}
+	}
+	if p.Scheme == "" {
+		c := *p
+		c.Scheme = scheme
+		p = &c
+	}
+	env.Principal = p
+}
+
+func unauthorized(env *r2.Env, challenge string, err error) {
+	env.W.Header().Set("WWW-Authenticate", challenge)
+	env.Error(http.StatusUnauthorized, err)
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aver-d/r2"
+)
+
+func TestAuth(t *testing.T) {
+	r := r2.NewRouter("")
+	who := func(e *r2.Env) { e.Text(200, e.Principal.Scheme+" "+e.Principal.Name) }
+
+	r.Get("/basic", who, r2.With(Basic("admin", Users(map[string]string{"ann": "secret"}))))
+	tokens := func(token string) (*r2.Principal, error) {
+		if token != "t0k3n" {
+			return nil, errors.New("unknown token")
+		}
+		return &r2.Principal{Name: "bob", Scopes: []string{"read"}}, nil
+	}
+	api := r.Group("/api", r2.With(Bearer("api", tokens)))
+	api.Get("/read", who, r2.With(Require("read")))
+	api.Get("/write", who, r2.With(Require("write")))
+	r.Get("/key", who, r2.With(APIKey("X-API-Key", "api_key", Keys(map[string]*r2.Principal{
+		"k1": {Name: "service"},
+	}))))
+
+	cases := []struct {
+		path, header, value string
+		status              int
+		body, challenge     string
+	}{
+		{"/basic", "", "", 401, "", `Basic realm="admin", charset="UTF-8"`},
+		{"/basic", "Authorization", "Basic YW5uOndyb25n", 401, "", `Basic realm="admin", charset="UTF-8"`},
+		{"/basic", "Authorization", "Basic YW5uOnNlY3JldA==", 200, "Basic ann", ""},
+		{"/api/read", "", "", 401, "", `Bearer realm="api"`},
+		{"/api/read", "Authorization", "Bearer nope", 401, "", `Bearer realm="api", error="invalid_token"`},
+		{"/api/read", "Authorization", "bearer t0k3n", 200, "Bearer bob", ""},
+		{"/api/write", "Authorization", "Bearer t0k3n", 403, "", ""},
+		{"/key", "X-API-Key", "k1", 200, "APIKey service", ""},
+		{"/key?api_key=k1", "", "", 200, "APIKey service", ""},
+		{"/key?api_key=k2", "", "", 401, "", `APIKey realm="api", header="X-API-Key", query="api_key"`},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.status || (c.body != "" && w.Body.String() != c.body) ||
+			w.Header().Get("WWW-Authenticate") != c.challenge {
+			t.Errorf("%v %v: unexpected response %v %q %q", c.path, c.value, w.Code, w.Body.String(), w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	check := Users(map[string]string{"ann": "secret", "bob": ""})
+	for _, c := range []struct {
+		user, password string
+		ok             bool
+	}{
+		{"ann", "secret", true},
+		{"ann", "Secret", false},
+		{"bob", "", true},
+		{"carl", "", false},
+	} {
+		if check(c.user, c.password) != c.ok {
+			t.Errorf("%v %q expected %v", c.user, c.password, c.ok)
+		}
+	}
+}
+
+func TestRejectionCause(t *testing.T) {
+	cause := errors.New("fetching https://keys.internal/jwks: 503 Service Unavailable")
+	r := r2.NewRouter("")
+	var logged error
+	r.ErrorHandler = func(e *r2.Env, status int, err error) {
+		logged = err
+		e.Text(status, err.Error())
+	}
+	r.Get("/", func(*r2.Env) {}, r2.With(Bearer("api", func(string) (*r2.Principal, error) { return nil, cause })))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer x")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 401 || w.Body.String() != ErrInvalid.Error() {
+		t.Errorf("unexpected response %v %q", w.Code, w.Body.String())
+	}
+	if !errors.Is(logged, ErrInvalid) || !errors.Is(logged, cause) {
+		t.Errorf("cause lost: %v", logged)
+	}
+}
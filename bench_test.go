@@ -0,0 +1,162 @@
+package r2
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// go test -run NONE -bench . -benchmem -r2.compare
+var compare = flag.Bool("r2.compare", false, "also run benchmarks against net/http.ServeMux")
+
+func nop(*Env) {}
+
+// constrained is the GitHub API with numeric ids and numbers
+func constrained() []*endpoint {
+	var eps []*endpoint
+	for _, ep := range githubAPI {
+		path := strings.Replace(ep.path, ":number", ":number!int", 1)
+		path = strings.Replace(path, ":id", ":id!int", 1)
+		eps = append(eps, &endpoint{ep.method, path, ep.handler})
+	}
+	return eps
+}
+
+func newRouter(endpoints []*endpoint) *Router {
+	r := NewRouter("")
+	for _, ep := range endpoints {
+		r.Route(ep.method, ep.path, nop)
+	}
+	return r
+}
+
+// muxPattern converts a pattern to ServeMux syntax, dropping constraints.
+func muxPattern(ep *endpoint) string {
+	parts := split(ep.path)
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			name, _, _ := strings.Cut(part[1:], regexSep)
+			parts[i] = "{" + name + "}"
+		}
+	}
+	return ep.method + " /" + strings.Join(parts, "/")
+}
+
+func newMux(endpoints []*endpoint) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, ep := range endpoints {
+		mux.HandleFunc(muxPattern(ep), func(http.ResponseWriter, *http.Request) {})
+	}
+	return mux
+}
+
+// muxable returns the endpoints ServeMux accepts, skipping those it rejects
+// as conflicting with earlier ones, so that both routers serve the same set.
+func muxable(endpoints []*endpoint) []*endpoint {
+	mux := http.NewServeMux()
+	var eps []*endpoint
+	for _, ep := range endpoints {
+		if registers(mux, muxPattern(ep)) {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+func registers(mux *http.ServeMux, pattern string) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	mux.HandleFunc(pattern, func(http.ResponseWriter, *http.Request) {})
+	return true
+}
+
+// requests for the endpoints, filling parameters with value, and only
+// for endpoints with or without parameters
+func requests(endpoints []*endpoint, params bool, value, suffix string) []*http.Request {
+	var reqs []*http.Request
+	for _, ep := range endpoints {
+		if strings.Contains(ep.path, ":") != params {
+			continue
+		}
+		parts := split(ep.path)
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") {
+				parts[i] = value
+			}
+		}
+		reqs = append(reqs, makeRequest(ep.method, "/"+strings.Join(parts, "/")+suffix))
+	}
+	return reqs
+}
+
+// benchmark serves the requests made for endpoints, limited when comparing
+// to those ServeMux accepts.
+func benchmark(b *testing.B, endpoints []*endpoint, requests func([]*endpoint) []*http.Request) {
+	all := len(endpoints)
+	if *compare {
+		endpoints = muxable(endpoints)
+	}
+	reqs := requests(endpoints)
+	b.Run("r2", func(b *testing.B) {
+		run(b, newRouter(endpoints), reqs)
+	})
+	if *compare {
+		b.Run("ServeMux", func(b *testing.B) {
+			if skipped := all - len(endpoints); skipped > 0 {
+				b.Logf("skipped %v of %v endpoints that ServeMux rejects", skipped, all)
+			}
+			run(b, newMux(endpoints), reqs)
+		})
+	}
+}
+
+func run(b *testing.B, h http.Handler, reqs []*http.Request) {
+	w := fakeResp{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, reqs[i%len(reqs)])
+	}
+}
+
+func BenchmarkStatic(b *testing.B) {
+	benchmark(b, githubAPI, func(eps []*endpoint) []*http.Request { return requests(eps, false, "", "") })
+}
+
+func BenchmarkParams(b *testing.B) {
+	benchmark(b, githubAPI, func(eps []*endpoint) []*http.Request { return requests(eps, true, "42", "") })
+}
+
+func BenchmarkRegex(b *testing.B) {
+	benchmark(b, constrained(), func(eps []*endpoint) []*http.Request { return requests(eps, true, "42", "") })
+}
+
+func BenchmarkNotFound(b *testing.B) {
+	benchmark(b, githubAPI, func(eps []*endpoint) []*http.Request { return requests(eps, true, "42", "/missing/parts") })
+}
+
+// the uncompiled trie, for comparison with the radix tree used by the router
+func BenchmarkTrie(b *testing.B) {
+	root := newRouter(githubAPI).root.Load()
+	paths := lookupPaths(githubAPI)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trieGet(root, paths[i%len(paths)])
+	}
+}
+
+func BenchmarkRadix(b *testing.B) {
+	r := newRouter(githubAPI)
+	paths := lookupPaths(githubAPI)
+	vars := make(Path, 0, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.get(paths[i%len(paths)], vars[:0])
+	}
+}
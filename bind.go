@@ -0,0 +1,102 @@
+package r2
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// bind sets the fields of the struct pointed to by v from values. Each field
+// is named by its tag, or else by the field name; a tag of "-" skips it.
+// When strict, keys naming no field are an error.
+func bind(values map[string][]string, v interface{}, tag string, strict bool) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("r2: bind expects a pointer to a struct, got %T", v)
+	}
+	s := ptr.Elem()
+	known := map[string]bool{}
+
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		name := field.Tag.Get(tag)
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		known[name] = true
+		vals, found := values[name]
+		if !found || len(vals) == 0 {
+			continue
+		}
+		if err := setField(s.Field(i), vals); err != nil {
+			return fmt.Errorf("r2: field %v: %v", name, err)
+		}
+	}
+	if strict {
+		for key := range values {
+			if !known[key] {
+				return fmt.Errorf("r2: unknown field %q", key)
+			}
+		}
+	}
+	return nil
+}
+
+func setField(f reflect.Value, vals []string) error {
+	if f.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(f.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+		return nil
+	}
+	if f.Kind() == reflect.Ptr {
+		elem := reflect.New(f.Type().Elem())
+		if err := setValue(elem.Elem(), vals[0]); err != nil {
+			return err
+		}
+		f.Set(elem)
+		return nil
+	}
+	return setValue(f, vals[0])
+}
+
+func setValue(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(x)
+	default:
+		return fmt.Errorf("unsupported type %v", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package r2
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("r2: unsupported media type")
+	ErrNotAcceptable        = errors.New("r2: no acceptable media type")
+)
+
+// Decoder reads request bodies of a media type.
+type Decoder interface {
+	// Decode reads the body of req into v. When strict, fields of the body
+	// with no counterpart in v are an error.
+	Decode(req *http.Request, v interface{}, strict bool) error
+}
+
+// Encoder writes response bodies of a media type.
+type Encoder interface {
+	Encode(w io.Writer, v interface{}) error
+}
+
+type codecs struct {
+	decoders map[string]Decoder
+	encoders map[string]Encoder
+	// media types of encoders in registration order; the first is used when
+	// the client accepts anything
+	order []string
+}
+
+func newCodecs() *codecs {
+	c := &codecs{decoders: map[string]Decoder{}, encoders: map[string]Encoder{}}
+	c.decoders["application/json"] = jsonCodec{}
+	c.decoders["application/xml"] = xmlCodec{}
+	c.decoders["text/xml"] = xmlCodec{}
+	c.decoders["application/x-www-form-urlencoded"] = formDecoder{}
+	c.decoders["multipart/form-data"] = multipartDecoder{}
+	c.addEncoder("application/json", jsonCodec{})
+	c.addEncoder("application/xml", xmlCodec{})
+	c.addEncoder("text/xml", xmlCodec{})
+	return c
+}
+
+// clone copies c, so that a change can be stored without a lock on reads.
+func (c *codecs) clone() *codecs {
+	n := &codecs{decoders: map[string]Decoder{}, encoders: map[string]Encoder{}}
+	for k, d := range c.decoders {
+		n.decoders[k] = d
+	}
+	for k, e := range c.encoders {
+		n.encoders[k] = e
+	}
+	n.order = append(n.order, c.order...)
+	return n
+}
+
+func (c *codecs) addEncoder(mediaType string, e Encoder) {
+	if _, found := c.encoders[mediaType]; !found {
+		c.order = append(c.order, mediaType)
+	}
+	c.encoders[mediaType] = e
+}
+
+// RegisterDecoder sets the decoder Env.Decode uses for a media type.
+func (r *Router) RegisterDecoder(mediaType string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.codecs.Load().clone()
+	c.decoders[mediaType] = d
+	r.codecs.Store(c)
+}
+
+// RegisterEncoder sets the encoder Env.Negotiate uses for a media type.
+func (r *Router) RegisterEncoder(mediaType string, e Encoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.codecs.Load().clone()
+	c.addEncoder(mediaType, e)
+	r.codecs.Store(c)
+}
+
+// Decode reads the request body into v with the decoder registered for its
+// Content-Type, limited to the router's MaxBodySize.
+func (e *Env) Decode(v interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(e.R.Header.Get("Content-Type"))
+	if err != nil {
+		return ErrUnsupportedMediaType
+	}
+	d, found := e.router.codecs.Load().decoders[mediaType]
+	if !found {
+		return ErrUnsupportedMediaType
+	}
+	if e.router.MaxBodySize > 0 && e.R.Body != nil {
+		e.R.Body = http.MaxBytesReader(e.W, e.R.Body, e.router.MaxBodySize)
+	}
+	return d.Decode(e.R, v, e.router.StrictDecoding)
+}
+
+// Negotiate writes v with the encoder best matching the Accept header.
+// ErrNotAcceptable is returned, and nothing written, if none match.
+func (e *Env) Negotiate(status int, v interface{}) error {
+	c := e.router.codecs.Load()
+	mediaType := c.negotiate(e.R.Header.Get("Accept"))
+	if mediaType == "" {
+		return ErrNotAcceptable
+	}
+	e.W.Header().Set("Content-Type", mediaType)
+	e.W.Header().Add("Vary", "Accept")
+	e.W.WriteHeader(status)
+	return c.encoders[mediaType].Encode(e.W, v)
+}
+
+type accepted struct {
+	mediaType string
+	q         float64
+}
+
+func (c *codecs) negotiate(accept string) string {
+	if len(c.order) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return c.order[0]
+	}
+	var ranges []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, found := params["q"]; found {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, accepted{mediaType, q})
+	}
+
+	// each media type takes the quality of its most specific range, so that
+	// q=0 excludes it whatever wildcards allow; ties go to the range listed
+	// first, then to registration order
+	best, bestQ, bestAt := "", 0.0, 0
+	for _, mediaType := range c.order {
+		q, at := quality(ranges, mediaType)
+		if q > bestQ || q == bestQ && q > 0 && at < bestAt {
+			best, bestQ, bestAt = mediaType, q, at
+		}
+	}
+	return best
+}
+
+// quality returns the quality given to a media type by its most specific
+// range, and the index of the range, or 0 if none match.
+func quality(ranges []accepted, mediaType string) (q float64, at int) {
+	specificity := -1
+	for i, a := range ranges {
+		s := -1
+		switch {
+		case a.mediaType == mediaType:
+			s = 2
+		case strings.HasSuffix(a.mediaType, "/*") && strings.HasPrefix(mediaType, a.mediaType[:len(a.mediaType)-1]):
+			s = 1
+		case a.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			specificity, q, at = s, a.q, i
+		}
+	}
+	return q, at
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(req *http.Request, v interface{}, strict bool) error {
+	d := json.NewDecoder(req.Body)
+	if strict {
+		d.DisallowUnknownFields()
+	}
+	return d.Decode(v)
+}
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// encoding/xml has no way to reject unknown elements, so strict is ignored.
+type xmlCodec struct{}
+
+func (xmlCodec) Decode(req *http.Request, v interface{}, strict bool) error {
+	return xml.NewDecoder(req.Body).Decode(v)
+}
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// formDecoder binds form values to a struct using "form" tags, or fills
+// a *url.Values.
+type formDecoder struct{}
+
+func (formDecoder) Decode(req *http.Request, v interface{}, strict bool) error {
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+	return bindForm(req.PostForm, v, strict)
+}
+
+// multipartMemory is the part of a multipart body held in memory, with the
+// rest stored in temporary files.
+const multipartMemory = 32 << 20
+
+// multipartDecoder binds like formDecoder, also setting fields of type
+// *multipart.FileHeader and []*multipart.FileHeader from uploaded files.
+type multipartDecoder struct{}
+
+var fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+
+func (multipartDecoder) Decode(req *http.Request, v interface{}, strict bool) error {
+	if err := req.ParseMultipartForm(multipartMemory); err != nil {
+		return err
+	}
+	form := req.MultipartForm
+	// include file names so strict binding knows about them
+	values := url.Values{}
+	for name, vals := range form.Value {
+		values[name] = vals
+	}
+	for name := range form.File {
+		if _, found := values[name]; !found {
+			values[name] = nil
+		}
+	}
+	if err := bindForm(values, v, strict); err != nil {
+		return err
+	}
+	s := reflect.ValueOf(v).Elem()
+	if s.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		name := field.Tag.Get("form")
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		files := form.File[name]
+		if len(files) == 0 {
+			continue
+		}
+		switch {
+		case field.Type == fileHeaderType:
+			s.Field(i).Set(reflect.ValueOf(files[0]))
+		case field.Type == reflect.SliceOf(fileHeaderType):
+			s.Field(i).Set(reflect.ValueOf(files))
+		}
+	}
+	return nil
+}
+
+func bindForm(values url.Values, v interface{}, strict bool) error {
+	if vals, ok := v.(*url.Values); ok {
+		*vals = values
+		return nil
+	}
+	return bind(values, v, "form", strict)
+}
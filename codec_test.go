@@ -0,0 +1,145 @@
+package r2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type signup struct {
+	Name   string                `json:"name" xml:"name" form:"name"`
+	Age    int                   `json:"age" xml:"age" form:"age"`
+	Tags   []string              `json:"tags" xml:"tag" form:"tag"`
+	Ignore string                `form:"-"`
+	Avatar *multipart.FileHeader `json:"-" xml:"-" form:"avatar"`
+}
+
+func decodeWith(setup func(*Router), contentType, body string) (*signup, error) {
+	var s signup
+	var err error
+	r := NewRouter("")
+	if setup != nil {
+		setup(r)
+	}
+	r.Post("/", func(e *Env) { err = e.Decode(&s) })
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return &s, err
+}
+
+func TestDecode(t *testing.T) {
+	cases := map[string]string{
+		"application/json":                  `{"name": "ann", "age": 30, "tags": ["a", "b"]}`,
+		"application/xml":                   `<signup><name>ann</name><age>30</age><tag>a</tag><tag>b</tag></signup>`,
+		"application/x-www-form-urlencoded": `name=ann&age=30&tag=a&tag=b&Ignore=x`,
+	}
+	for contentType, body := range cases {
+		s, err := decodeWith(nil, contentType, body)
+		if err != nil || s.Name != "ann" || s.Age != 30 || len(s.Tags) != 2 || s.Ignore != "" {
+			t.Errorf("%v: unexpected %+v %v", contentType, s, err)
+		}
+	}
+	if _, err := decodeWith(nil, "text/plain", "hi"); err != ErrUnsupportedMediaType {
+		t.Errorf("expected unsupported media type, got %v", err)
+	}
+}
+
+func TestDecodeMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "ann")
+	fw, _ := mw.CreateFormFile("avatar", "me.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+
+	strict := func(r *Router) { r.StrictDecoding = true }
+	s, err := decodeWith(strict, mw.FormDataContentType(), body.String())
+	if err != nil || s.Name != "ann" || s.Avatar == nil || s.Avatar.Filename != "me.png" {
+		t.Errorf("unexpected %+v %v", s, err)
+	}
+	// unexported fields are left alone
+	var hidden struct {
+		Name   string                `form:"name"`
+		avatar *multipart.FileHeader `form:"avatar"`
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if err := (multipartDecoder{}).Decode(req, &hidden, false); err != nil || hidden.avatar != nil {
+		t.Errorf("unexpected %+v %v", hidden, err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	strict := func(r *Router) { r.StrictDecoding = true }
+	if _, err := decodeWith(strict, "application/json", `{"name": "ann", "extra": 1}`); err == nil {
+		t.Error("expected unknown field error")
+	}
+	if _, err := decodeWith(strict, "application/x-www-form-urlencoded", `name=ann&extra=1`); err == nil {
+		t.Error("expected unknown field error")
+	}
+	limit := func(r *Router) { r.MaxBodySize = 10 }
+	if _, err := decodeWith(limit, "application/json", `{"name": "a long name"}`); err == nil {
+		t.Error("expected body too large")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	r := NewRouter("")
+	r.Get("/", func(e *Env) {
+		if err := e.Negotiate(200, signup{Name: "ann"}); err != nil {
+			e.Error(http.StatusNotAcceptable, err)
+		}
+	})
+	cases := map[string]string{
+		"":                                     "application/json",
+		"text/html, application/xml;q=0.9":     "application/xml",
+		"application/xml;q=0.5, application/*": "application/json",
+		"text/*":                               "text/xml",
+		"image/png":                            "application/json; charset=utf-8",
+		"application/json;q=0, */*":            "application/xml",
+		"*/*;q=0":                              "application/json; charset=utf-8",
+		"application/xml, application/json":    "application/xml",
+	}
+	for accept, want := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Type"); got != want {
+			t.Errorf("%q expected %v, got %v", accept, want, got)
+		}
+	}
+}
+
+type textEncoder struct{}
+
+func (textEncoder) Encode(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+func TestRegisterWhileServing(t *testing.T) {
+	r := NewRouter("")
+	r.Get("/", func(e *Env) { e.Negotiate(200, "hi") })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			r.RegisterEncoder(fmt.Sprintf("text/x-%v", i), textEncoder{})
+		}
+		r.RegisterEncoder("text/plain", textEncoder{})
+	}()
+	for i := 0; i < 100; i++ {
+		request(r, "GET", "/", map[string]string{"Accept": "text/plain"})
+	}
+	<-done
+	if w := request(r, "GET", "/", map[string]string{"Accept": "text/plain"}); w.Body.String() != "hi" {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+}
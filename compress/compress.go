@@ -0,0 +1,316 @@
+// Package compress compresses responses of an r2 Router with the content
+// coding the client prefers from those it accepts.
+package compress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aver-d/r2"
+)
+
+// MetaKey is the route metadata that, set to false, turns compression off
+// for the route.
+const MetaKey = "compress"
+
+// Encoding is a content coding, such as gzip. Others, brotli for one, can
+// be added by implementing it.
+type Encoding interface {
+	// the token of the coding in Accept-Encoding and Content-Encoding
+	Name() string
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+type gzipEncoding int
+
+func (gzipEncoding) Name() string { return "gzip" }
+
+// NewWriter can't fail, as Gzip only makes valid levels.
+func (level gzipEncoding) NewWriter(w io.Writer) io.WriteCloser {
+	z, _ := gzip.NewWriterLevel(w, int(level))
+	return z
+}
+
+type deflateEncoding int
+
+func (deflateEncoding) Name() string { return "deflate" }
+
+// NewWriter can't fail, as Deflate only makes valid levels.
+func (level deflateEncoding) NewWriter(w io.Writer) io.WriteCloser {
+	z, _ := flate.NewWriter(w, int(level))
+	return z
+}
+
+// Gzip and Deflate return encodings compressing at the given level of
+// compress/flate. Levels out of its range use flate.DefaultCompression.
+func Gzip(level int) Encoding    { return gzipEncoding(validLevel(level)) }
+func Deflate(level int) Encoding { return deflateEncoding(validLevel(level)) }
+
+func validLevel(level int) int {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+// DefaultSkip lists content types that are compressed already.
+var DefaultSkip = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/pdf",
+}
+
+type Compressor struct {
+	// Encodings in order of preference, for clients that accept several
+	// equally.
+	Encodings []Encoding
+	// MinSize is the smallest body compressed. Smaller bodies would grow.
+	MinSize int
+	// Skip lists content types, or prefixes of them, not compressed.
+	Skip []string
+}
+
+func New() *Compressor {
+	return &Compressor{
+		Encodings: []Encoding{Gzip(gzip.DefaultCompression), Deflate(flate.DefaultCompression)},
+		MinSize:   1024,
+		Skip:      DefaultSkip,
+	}
+}
+
+// Middleware compresses the responses of routes unless their metadata
+// turns it off.
+func (c *Compressor) Middleware(next r2.Handler) r2.Handler {
+	return func(env *r2.Env) {
+		if on, ok := env.Meta(MetaKey).(bool); ok && !on {
+			next(env)
+			return
+		}
+		env.W.Header().Add("Vary", "Accept-Encoding")
+		enc := c.negotiate(env.R.Header.Get("Accept-Encoding"))
+		if enc == nil || env.R.Method == http.MethodHead {
+			next(env)
+			return
+		}
+		w := &writer{ResponseWriter: env.W, c: c, enc: enc}
+		env.W = w
+		completed := false
+		defer func() {
+			env.W = w.ResponseWriter
+			// after a panic, a body not yet sent is dropped so that
+			// PanicHandler can still answer, and one being sent is ended
+			if completed || w.decided {
+				w.Close()
+			}
+		}()
+		next(env)
+		completed = true
+	}
+}
+
+// negotiate picks the encoding of highest quality in the Accept-Encoding
+// header, or nil for none.
+func (c *Compressor) negotiate(accept string) Encoding {
+	if accept == "" {
+		return nil
+	}
+	var best Encoding
+	bestQ := 0.0
+	for _, enc := range c.Encodings {
+		if q := quality(accept, enc.Name()); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// quality returns the q value of coding in an Accept-Encoding header, with
+// "*" standing for codings not listed.
+func quality(accept, coding string) float64 {
+	wildcard := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if strings.EqualFold(name, coding) {
+			return q
+		}
+		if name == "*" {
+			wildcard = q
+		}
+	}
+	return max(wildcard, 0)
+}
+
+// writer holds back the body until MinSize bytes are written, a flush or
+// the end of the response, then decides whether to compress it.
+type writer struct {
+	http.ResponseWriter
+	c      *Compressor
+	enc    Encoding
+	status int
+	buf    []byte
+	// set once decided, zw only if compressing
+	decided bool
+	zw      io.WriteCloser
+}
+
+func (w *writer) WriteHeader(status int) {
+	if w.status != 0 || w.decided {
+		return
+	}
+	// informational responses, such as 103 Early Hints, precede the final one
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	// responses without a body pass straight through
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.c.MinSize {
+			return len(b), nil
+		}
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// start decides on compressing from the buffered body, and writes it.
+func (w *writer) start() error {
+	w.decide(w.compressible())
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *writer) compressible() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || len(w.buf) == 0 {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		// as net/http would when the header is written
+		ct = http.DetectContentType(w.buf)
+		h.Set("Content-Type", ct)
+	}
+	for _, skip := range w.c.Skip {
+		if strings.HasPrefix(ct, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *writer) decide(compress bool) {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.enc.Name())
+		h.Del("Content-Length")
+		// a strong validator no longer matches the bytes sent
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.zw = w.enc.NewWriter(w.ResponseWriter)
+	}
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush sends what has been written so far, compressing a streamed
+// response regardless of MinSize.
+func (w *writer) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.start()
+	}
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("compress: response does not support hijacking")
+	}
+	// nothing more is written through w
+	w.decided = true
+	return h.Hijack()
+}
+
+// Status reports the status written, so that Env.Committed sees it while
+// the body is held back.
+func (w *writer) Status() int {
+	return w.status
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close ends the response, writing a body too small to compress as it is.
+func (w *writer) Close() error {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// nothing was written; leave the response to whoever follows
+			return nil
+		}
+		w.decide(false)
+		_, err := w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+		return err
+	}
+	if w.zw != nil {
+		err := w.zw.Close()
+		w.zw = nil
+		return err
+	}
+	return nil
+}
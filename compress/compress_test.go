@@ -0,0 +1,180 @@
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aver-d/r2"
+)
+
+var long = strings.Repeat("all work and no play ", 100)
+
+func TestCompress(t *testing.T) {
+	r := r2.NewRouter("")
+	r.Use(New().Middleware)
+	r.Get("/text", func(e *r2.Env) { e.Text(200, long) })
+	r.Get("/small", func(e *r2.Env) { e.Text(200, "hi") })
+	r.Get("/image", func(e *r2.Env) { e.Blob(200, "image/png", []byte(long)) })
+	r.Get("/sniffed", func(e *r2.Env) { e.W.Write([]byte(long)) })
+	r.Get("/off", func(e *r2.Env) { e.Text(200, long) }, r2.Meta(MetaKey, false))
+	r.Get("/empty", func(e *r2.Env) { e.NoContent() })
+	r.Get("/etag", func(e *r2.Env) {
+		e.W.Header().Set("ETag", `"v1"`)
+		e.Text(200, long)
+	})
+
+	cases := []struct {
+		path, accept, encoding, body string
+	}{
+		{"/text", "gzip, deflate", "gzip", long},
+		{"/text", "deflate;q=1, gzip;q=0.5", "deflate", long},
+		{"/text", "*", "gzip", long},
+		{"/text", "gzip;q=0, *;q=0.1", "deflate", long},
+		{"/text", "br", "", long},
+		{"/text", "", "", long},
+		{"/small", "gzip", "", "hi"},
+		{"/image", "gzip", "", long},
+		{"/sniffed", "gzip", "gzip", long},
+		{"/off", "gzip", "", long},
+		{"/empty", "gzip", "", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept-Encoding", c.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Encoding"); got != c.encoding {
+			t.Errorf("%v %q: expected encoding %q, got %q", c.path, c.accept, c.encoding, got)
+			continue
+		}
+		if vary := w.Header().Get("Vary"); (vary == "Accept-Encoding") == (c.path == "/off") {
+			t.Errorf("%v: unexpected Vary %q", c.path, vary)
+		}
+		var body io.Reader = w.Body
+		switch c.encoding {
+		case "gzip":
+			body, _ = gzip.NewReader(w.Body)
+		case "deflate":
+			body = flate.NewReader(w.Body)
+		}
+		b, _ := io.ReadAll(body)
+		if string(b) != c.body {
+			t.Errorf("%v %q: unexpected body %q", c.path, c.accept, b)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/etag", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Header().Get("ETag") != `W/"v1"` {
+		t.Errorf("expected weakened ETag, got %v", w.Header().Get("ETag"))
+	}
+}
+
+func TestFlush(t *testing.T) {
+	r := r2.NewRouter("")
+	r.Use(New().Middleware)
+	r.Get("/stream", func(e *r2.Env) {
+		e.W.Header().Set("Content-Type", "text/event-stream")
+		e.W.Write([]byte("data: 1\n\n"))
+		e.W.(http.Flusher).Flush()
+		e.W.Write([]byte("data: 2\n\n"))
+	})
+	req := httptest.NewRequest("GET", "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !w.Flushed || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("stream not flushed compressed: %v", w.Header())
+	}
+	z, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(z); string(b) != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("unexpected body %q", b)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	r := r2.NewRouter("")
+	r.PanicHandler = func(e *r2.Env, v interface{}) {
+		if !e.Committed() {
+			e.Text(500, "recovered")
+		}
+	}
+	r.Use(New().Middleware)
+	r.Get("/panic", func(e *r2.Env) {
+		e.Text(200, "partial")
+		panic("oops")
+	})
+	req := httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 500 || w.Body.String() != "recovered" || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("unexpected response %v %q %v", w.Code, w.Body.String(), w.Header())
+	}
+}
+
+func TestLevel(t *testing.T) {
+	for _, enc := range []Encoding{Gzip(42), Deflate(-7)} {
+		var b strings.Builder
+		z := enc.NewWriter(&b)
+		if z == nil {
+			t.Fatalf("%v: nil writer for invalid level", enc.Name())
+		}
+		z.Write([]byte(long))
+		z.Close()
+	}
+}
+
+// statusRecorder records every status written, including informational ones.
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.codes = append(w.codes, status)
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func TestInformational(t *testing.T) {
+	r := r2.NewRouter("")
+	r.Use(New().Middleware)
+	r.Get("/", func(e *r2.Env) {
+		e.W.WriteHeader(http.StatusEarlyHints)
+		e.Text(200, long)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(w, req)
+	if len(w.codes) != 2 || w.codes[0] != 103 || w.codes[1] != 200 || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("unexpected response %v %v", w.codes, w.Header())
+	}
+}
+
+func TestCommitted(t *testing.T) {
+	r := r2.NewRouter("")
+	r.Use(New().Middleware)
+	r.Get("/", func(e *r2.Env) {
+		e.Text(200, "partial")
+		e.Error(500, errors.New("x"))
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 200 || w.Body.String() != "partial" {
+		t.Errorf("unexpected response %v %q", w.Code, w.Body.String())
+	}
+}
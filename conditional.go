@@ -0,0 +1,224 @@
+package r2
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns an entity tag for a body, weak if the body may differ in
+// bytes but not in meaning, as it does when compressed.
+func ETag(b []byte, weak bool) string {
+	sum := sha256.Sum256(b)
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if weak {
+		tag = "W/" + tag
+	}
+	return tag
+}
+
+// Precondition sets the ETag and Last-Modified headers from etag and
+// modified, either of which may be empty, and evaluates the conditional
+// headers of the request against them. If a condition fails it writes 304
+// Not Modified or 412 Precondition Failed and returns false, and the
+// handler should write nothing more.
+func (e *Env) Precondition(etag string, modified time.Time) bool {
+	h := e.W.Header()
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	req := e.R
+	safe := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	if match := req.Header.Get("If-Match"); match != "" {
+		if !matchETag(match, etag, false) {
+			e.Error(http.StatusPreconditionFailed, nil)
+			return false
+		}
+	} else if since, ok := headerTime(req, "If-Unmodified-Since"); ok && !modified.IsZero() {
+		if modified.Truncate(time.Second).After(since) {
+			e.Error(http.StatusPreconditionFailed, nil)
+			return false
+		}
+	}
+
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		if matchETag(match, etag, true) {
+			if safe {
+				notModified(e)
+			} else {
+				e.Error(http.StatusPreconditionFailed, nil)
+			}
+			return false
+		}
+	} else if since, ok := headerTime(req, "If-Modified-Since"); ok && safe && !modified.IsZero() {
+		if !modified.Truncate(time.Second).After(since) {
+			notModified(e)
+			return false
+		}
+	}
+	return true
+}
+
+func notModified(e *Env) {
+	h := e.W.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	e.W.WriteHeader(http.StatusNotModified)
+}
+
+// matchETag reports whether etag is in a list of entity tags. Weak
+// comparison ignores the W/ prefix; strong comparison never matches weak
+// tags.
+func matchETag(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if !weak && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func headerTime(req *http.Request, name string) (time.Time, bool) {
+	v := req.Header.Get(name)
+	if v == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(v)
+	return t, err == nil
+}
+
+// Conditional returns middleware that buffers successful responses to GET
+// and HEAD requests, tags any without an ETag with one computed from the
+// body, and answers their conditional headers with Env.Precondition.
+// Streamed responses are passed on unbuffered from their first flush.
+func Conditional(weak bool) Middleware {
+	return func(next Handler) Handler {
+		return func(env *Env) {
+			if env.R.Method != http.MethodGet && env.R.Method != http.MethodHead {
+				next(env)
+				return
+			}
+			w := &bufferedResponse{ResponseWriter: env.W}
+			env.W = w
+			completed := false
+			defer func() {
+				env.W = w.ResponseWriter
+				// after a panic the buffer is dropped, so that PanicHandler
+				// can still answer
+				if completed && !w.passing {
+					w.finish(env, weak)
+				}
+			}()
+			next(env)
+			completed = true
+		}
+	}
+}
+
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	// set once the response is written through unbuffered
+	passing bool
+}
+
+func (w *bufferedResponse) WriteHeader(status int) {
+	if w.passing || (w.status == 0 && informational(status)) {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponse) Write(b []byte) (int, error) {
+	if w.passing {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// pass writes out what is buffered and stops buffering.
+func (w *bufferedResponse) pass() {
+	if w.passing {
+		return
+	}
+	w.passing = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+}
+
+func (w *bufferedResponse) Flush() {
+	w.pass()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *bufferedResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("r2: response does not support hijacking")
+	}
+	w.passing = true
+	return h.Hijack()
+}
+
+// Status reports the status written, so that Env.Committed sees it.
+func (w *bufferedResponse) Status() int {
+	return w.status
+}
+
+func (w *bufferedResponse) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish answers the request from the buffered response.
+func (w *bufferedResponse) finish(env *Env, weak bool) {
+	if w.status != http.StatusOK {
+		w.pass()
+		return
+	}
+	h := w.Header()
+	etag := h.Get("ETag")
+	if etag == "" {
+		etag = ETag(w.body.Bytes(), weak)
+	}
+	modified, _ := http.ParseTime(h.Get("Last-Modified"))
+	if !env.Precondition(etag, modified) {
+		return
+	}
+	w.pass()
+}
@@ -0,0 +1,130 @@
+package r2
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrecondition(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	r := NewRouter("")
+	h := func(e *Env) {
+		if e.Precondition(`"v2"`, modified) {
+			e.Text(200, "body")
+		}
+	}
+	r.Get("/doc", h)
+	r.Put("/doc", h)
+
+	cases := []struct {
+		method, header, value string
+		status                int
+	}{
+		{"GET", "", "", 200},
+		{"GET", "If-None-Match", `"v1", W/"v2"`, 304},
+		{"GET", "If-None-Match", `"v1"`, 200},
+		{"GET", "If-None-Match", `*`, 304},
+		{"HEAD", "If-None-Match", `"v2"`, 304},
+		{"PUT", "If-None-Match", `"v2"`, 412},
+		{"GET", "If-Modified-Since", after, 304},
+		{"GET", "If-Modified-Since", before, 200},
+		{"PUT", "If-Modified-Since", after, 200},
+		{"PUT", "If-Match", `"v2"`, 200},
+		{"PUT", "If-Match", `W/"v2"`, 412},
+		{"PUT", "If-Match", `"v1"`, 412},
+		{"PUT", "If-Unmodified-Since", before, 412},
+		{"PUT", "If-Unmodified-Since", after, 200},
+	}
+	for _, c := range cases {
+		w := request(r, c.method, "/doc", map[string]string{c.header: c.value})
+		if w.Code != c.status {
+			t.Errorf("%v %v %v: expected %v, got %v", c.method, c.header, c.value, c.status, w.Code)
+		}
+		if w.Header().Get("ETag") != `"v2"` || w.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+			t.Errorf("%v %v: missing validators %v", c.method, c.header, w.Header())
+		}
+		if c.status == 304 && w.Body.Len() != 0 {
+			t.Errorf("%v %v: unexpected body for 304", c.method, c.header)
+		}
+	}
+}
+
+func TestConditional(t *testing.T) {
+	r := NewRouter("")
+	r.Use(Conditional(false))
+	r.Get("/doc", func(e *Env) { e.Text(200, "body") })
+	r.Get("/missing", func(e *Env) { e.Text(404, "body") })
+	r.Post("/doc", func(e *Env) { e.Text(200, "posted") })
+
+	etag := ETag([]byte("body"), false)
+	w := serve(r, "GET", "/doc")
+	if w.Code != 200 || w.Body.String() != "body" || w.Header().Get("ETag") != etag {
+		t.Fatalf("unexpected response %v %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	if w := request(r, "GET", "/doc", map[string]string{"If-None-Match": etag}); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("expected 304, got %v %q", w.Code, w.Body.String())
+	}
+	// HEAD falls back to the GET route
+	if w := request(r, "HEAD", "/doc", map[string]string{"If-None-Match": etag}); w.Code != 304 {
+		t.Errorf("HEAD expected 304, got %v", w.Code)
+	}
+	if w := request(r, "GET", "/missing", map[string]string{"If-None-Match": "*"}); w.Code != 404 || w.Header().Get("ETag") != "" {
+		t.Errorf("unexpected response to error %v %v", w.Code, w.Header())
+	}
+	if w := serve(r, "POST", "/doc"); w.Body.String() != "posted" || w.Header().Get("ETag") != "" {
+		t.Errorf("unexpected response to POST %v", w.Header())
+	}
+	if got := ETag([]byte("body"), true); got != "W/"+etag {
+		t.Errorf("unexpected weak tag %v", got)
+	}
+}
+
+func TestConditionalPanic(t *testing.T) {
+	r := NewRouter("")
+	r.PanicHandler = func(e *Env, v interface{}) {
+		if !e.Committed() {
+			e.Text(500, "recovered")
+		}
+	}
+	r.Use(Conditional(false))
+	r.Get("/panic", func(e *Env) {
+		e.Text(200, "partial")
+		panic("oops")
+	})
+	w := serve(r, "GET", "/panic")
+	if w.Code != 500 || w.Body.String() != "recovered" || w.Header().Get("ETag") != "" {
+		t.Errorf("unexpected response %v %q %v", w.Code, w.Body.String(), w.Header())
+	}
+}
+
+func TestConditionalInformational(t *testing.T) {
+	r := NewRouter("")
+	r.Use(Conditional(false))
+	r.Get("/", func(e *Env) {
+		e.W.WriteHeader(http.StatusEarlyHints)
+		e.Text(200, "hi")
+	})
+	w := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(w.codes) != 2 || w.codes[0] != 103 || w.codes[1] != 200 || w.Body.String() != "hi" {
+		t.Errorf("unexpected statuses %v %q", w.codes, w.Body)
+	}
+}
+
+func TestConditionalCommitted(t *testing.T) {
+	r := NewRouter("")
+	r.Use(Conditional(false))
+	r.Get("/", func(e *Env) {
+		e.Text(200, "partial")
+		e.Error(500, errors.New("x"))
+	})
+	if w := serve(r, "GET", "/"); w.Code != 200 || w.Body.String() != "partial" {
+		t.Errorf("unexpected response %v %q", w.Code, w.Body.String())
+	}
+}
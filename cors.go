@@ -0,0 +1,187 @@
+package r2
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS configures cross-origin requests. Preflight requests are answered
+// by the router from the methods registered for the path, unless an
+// OPTIONS route is registered for it.
+type CORS struct {
+	// Origins allowed, each either "*" for any origin or an origin that
+	// may contain one "*", as in "https://*.example.com".
+	//
+	// With Credentials, "*" is ignored and Lint reports it as an error:
+	// allowing credentials from any origin would let every site act as the
+	// user. List the trusted origins instead.
+	Origins []string
+	// Headers a request may send. If nil, any headers requested are allowed.
+	Headers []string
+	// Expose lists response headers readable by scripts.
+	Expose []string
+	// Credentials allows cookies and authorization headers.
+	Credentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// CrossOrigin sets the CORS configuration of a route, in place of the
+// router's.
+func CrossOrigin(c *CORS) Option {
+	return func(route *Route) {
+		route.cors = c
+	}
+}
+
+func (r *Router) corsFor(route *Route) *CORS {
+	if route.cors != nil {
+		return route.cors
+	}
+	return r.CORS
+}
+
+func (c *CORS) allows(origin string) bool {
+	for _, o := range c.Origins {
+		if o == "*" {
+			if c.Credentials {
+				continue
+			}
+			return true
+		}
+		if o == origin {
+			return true
+		}
+		before, after, found := strings.Cut(o, "*")
+		if found && len(origin) > len(before)+len(after) &&
+			strings.HasPrefix(origin, before) && strings.HasSuffix(origin, after) {
+			return true
+		}
+	}
+	return false
+}
+
+// public reports whether every origin gets the same response, with an
+// Access-Control-Allow-Origin of "*", so that caches needn't vary by Origin.
+func (c *CORS) public() bool {
+	return !c.Credentials && slices.Contains(c.Origins, "*")
+}
+
+// allowOrigin sets the headers common to preflight and actual responses
+// from an allowed origin.
+func (c *CORS) allowOrigin(h http.Header, origin string) {
+	if c.public() {
+		origin = "*"
+	}
+	if c.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+}
+
+// decorate sets the CORS headers of a response to a matched request.
+func (r *Router) decorate(env *Env, route *Route) {
+	c := r.corsFor(route)
+	if c == nil {
+		return
+	}
+	h := env.W.Header()
+	origin := env.R.Header.Get("Origin")
+	if c.public() {
+		// the same for every request, with an Origin or not
+		origin = "*"
+	} else {
+		// responses to other origins, or to none, mustn't be reused for this one
+		h.Add("Vary", "Origin")
+		if origin == "" || !c.allows(origin) {
+			return
+		}
+	}
+	c.allowOrigin(h, origin)
+	if len(c.Expose) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.Expose, ", "))
+	}
+}
+
+// preflight answers a CORS preflight request, reporting false if it isn't
+// one the router handles.
+func (r *Router) preflight(env *Env, routes map[string]*target) bool {
+	req := env.R
+	if req.Method != http.MethodOptions || routes[http.MethodOptions] != nil {
+		return false
+	}
+	origin, method := req.Header.Get("Origin"), req.Header.Get("Access-Control-Request-Method")
+	if origin == "" || method == "" {
+		return false
+	}
+	t := routes[method]
+	if t == nil {
+		t = routes[any]
+	}
+	var c *CORS
+	if t != nil {
+		c = r.corsFor(t.route)
+	}
+	if c == nil {
+		return false
+	}
+
+	h := env.W.Header()
+	if !c.public() {
+		h.Add("Vary", "Origin")
+	}
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if c.allows(origin) {
+		c.allowOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(r.corsMethods(routes, method, origin), ", "))
+		if c.Headers != nil {
+			h.Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+		} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+	}
+	env.W.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// corsMethods returns the methods of routes that allow origin, with the
+// requested method standing in for a route matching any method.
+func (r *Router) corsMethods(routes map[string]*target, requested, origin string) []string {
+	var methods []string
+	for method, t := range routes {
+		c := r.corsFor(t.route)
+		if c == nil || !c.allows(origin) {
+			continue
+		}
+		if method == any {
+			method = requested
+			if routes[method] != nil {
+				continue
+			}
+		}
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// allowed returns the methods of routes, for the Allow header of a 405.
+func allowed(routes map[string]*target) string {
+	methods := make([]string, 0, len(routes)+1)
+	for method := range routes {
+		methods = append(methods, method)
+	}
+	if routes[http.MethodGet] != nil && routes[http.MethodHead] == nil {
+		methods = append(methods, http.MethodHead)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
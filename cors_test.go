@@ -0,0 +1,120 @@
+package r2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func request(r *Router, method, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORS(t *testing.T) {
+	r := NewRouter("")
+	r.CORS = &CORS{Origins: []string{"https://*.example.com"}, Expose: []string{"X-Total"}, MaxAge: time.Hour}
+	r.Get("/items", f4)
+	r.Post("/items", f4)
+	r.Delete("/items", f4, CrossOrigin(&CORS{Origins: []string{"https://admin.example.com"}}))
+	public := r.Group("/public", CrossOrigin(&CORS{Origins: []string{"*"}, Headers: []string{"Content-Type"}}))
+	public.Handle("/feed", f4)
+
+	cases := []struct {
+		name, method, path, origin, requested string
+		status                                int
+		want                                  map[string]string
+	}{
+		{"preflight", "OPTIONS", "/items", "https://app.example.com", "POST", 204, map[string]string{
+			"Access-Control-Allow-Origin":  "https://app.example.com",
+			"Access-Control-Allow-Methods": "GET, POST",
+			"Access-Control-Allow-Headers": "X-Custom",
+			"Access-Control-Max-Age":       "3600",
+		}},
+		{"route configuration", "OPTIONS", "/items", "https://admin.example.com", "DELETE", 204, map[string]string{
+			"Access-Control-Allow-Origin":  "https://admin.example.com",
+			"Access-Control-Allow-Methods": "DELETE, GET, POST",
+		}},
+		{"origin refused", "OPTIONS", "/items", "https://example.org", "GET", 204, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"wildcard needs subdomain", "OPTIONS", "/items", "https://.example.com", "GET", 204, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"group", "OPTIONS", "/public/feed", "https://example.org", "PUT", 204, map[string]string{
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Methods": "PUT",
+			"Access-Control-Allow-Headers": "Content-Type",
+		}},
+		{"actual request", "GET", "/items", "https://app.example.com", "", 200, map[string]string{
+			"Access-Control-Allow-Origin":   "https://app.example.com",
+			"Access-Control-Expose-Headers": "X-Total",
+			"Vary":                          "Origin",
+		}},
+		{"not preflight", "OPTIONS", "/items", "https://app.example.com", "", 405, map[string]string{
+			"Allow": "DELETE, GET, HEAD, POST",
+		}},
+	}
+	for _, c := range cases {
+		header := map[string]string{"Origin": c.origin, "Access-Control-Request-Headers": "X-Custom"}
+		if c.requested != "" {
+			header["Access-Control-Request-Method"] = c.requested
+		}
+		w := request(r, c.method, c.path, header)
+		if w.Code != c.status {
+			t.Errorf("%v: expected status %v, got %v", c.name, c.status, w.Code)
+		}
+		for k, v := range c.want {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%v: %v expected %q, got %q", c.name, k, v, got)
+			}
+		}
+	}
+}
+
+func TestCORSOptionsRoute(t *testing.T) {
+	r := NewRouter("")
+	r.CORS = &CORS{Origins: []string{"*"}}
+	r.Route(http.MethodOptions, "/items", func(e *Env) { e.Text(200, "custom") })
+	w := request(r, "OPTIONS", "/items", map[string]string{"Origin": "https://a.com", "Access-Control-Request-Method": "GET"})
+	if w.Body.String() != "custom" {
+		t.Errorf("preflight not passed to OPTIONS route: %v", w.Code)
+	}
+}
+
+func TestCORSVary(t *testing.T) {
+	r := NewRouter("")
+	r.CORS = &CORS{Origins: []string{"https://a.com"}}
+	r.Get("/private", f4)
+	r.Get("/public", f4, CrossOrigin(&CORS{Origins: []string{"*"}}))
+	r.Get("/credentials", f4, CrossOrigin(&CORS{Origins: []string{"*"}, Credentials: true}))
+
+	cases := []struct {
+		path, origin, allow, vary string
+	}{
+		{"/private", "", "", "Origin"},
+		{"/private", "https://b.com", "", "Origin"},
+		{"/private", "https://a.com", "https://a.com", "Origin"},
+		{"/public", "", "*", ""},
+		{"/public", "https://b.com", "*", ""},
+		{"/credentials", "https://b.com", "", "Origin"},
+	}
+	for _, c := range cases {
+		w := request(r, "GET", c.path, map[string]string{"Origin": c.origin})
+		if w.Header().Get("Access-Control-Allow-Origin") != c.allow || w.Header().Get("Vary") != c.vary ||
+			w.Header().Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("%v %q: unexpected headers %v", c.path, c.origin, w.Header())
+		}
+	}
+
+	issues := r.Lint().AtLeast(SeverityError)
+	if len(issues) != 1 || issues[0].Check != "cors" || issues[0].Pattern != "/credentials" {
+		t.Errorf("unexpected issues %v", issues)
+	}
+}
@@ -0,0 +1,69 @@
+package r2
+
+import "fmt"
+
+// Add registers a route like Route, but returns an error rather than exiting
+// on a conflict. It is safe to call while the router is serving requests.
+func (r *Router) Add(method, path string, handler Handler, opts ...Option) error {
+	return r.insert(method, path, handler, opts, false)
+}
+
+// Replace swaps the handler and options of an existing route. Requests
+// already dispatched finish with the old handler.
+func (r *Router) Replace(method, path string, handler Handler, opts ...Option) error {
+	return r.insert(method, path, handler, opts, true)
+}
+
+// Remove unregisters the route for method and path, dropping any parts of the
+// path left with neither routes nor children. It is safe to call while the
+// router is serving requests.
+func (r *Router) Remove(method, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	root := r.root.Load().clone()
+	// nodes along the path, copied, with the keys leading to them
+	nodes := []*trieNode{root}
+	var keys []string
+
+	if path != "/" {
+		parts := split(path)
+		for i, part := range parts {
+			if part == exact && i == len(parts)-1 {
+				break
+			}
+			key, name, _, err := r.separate(part)
+			if err != nil {
+				return err
+			}
+			parent := nodes[len(nodes)-1]
+			child, found := parent.children[key]
+			if !found || key != name && child.paramName != name {
+				return fmt.Errorf("no route found for path %v", path)
+			}
+			child = child.clone()
+			parent.children[key] = child
+			nodes = append(nodes, child)
+			keys = append(keys, key)
+		}
+	}
+
+	node := nodes[len(nodes)-1]
+	if _, found := node.handlers[method]; !found {
+		return fmt.Errorf("no method %v found for path %v", method, path)
+	}
+	delete(node.handlers, method)
+	if len(node.handlers) == 0 {
+		node.handlers = nil
+	}
+
+	// prune empty nodes, leaving the root
+	for i := len(nodes) - 1; i > 0; i-- {
+		if len(nodes[i].handlers) > 0 || len(nodes[i].children) > 0 {
+			break
+		}
+		delete(nodes[i-1].children, keys[i-1])
+	}
+	r.store(root)
+	return nil
+}
@@ -0,0 +1,84 @@
+package r2
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestAddReplaceRemove(t *testing.T) {
+	r := NewRouter("")
+	r.Get("/users/:id", f1)
+
+	if err := r.Add("GET", "/users/:id", f2); err == nil {
+		t.Error("expected duplicate route error")
+	}
+	if err := r.Add("GET", "/users/:name/posts", f2); err == nil {
+		t.Error("expected parameter conflict error")
+	}
+	if err := r.Add("GET", "/users/:id/posts/:n!(", f2); err == nil {
+		t.Error("expected regex error")
+	}
+	if err := r.Add("GET", "/users/:id/posts", f2); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, r, "GET", "/users/1/posts", 2)
+
+	if err := r.Replace("GET", "/users/:id", f3); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, r, "GET", "/users/1", 3)
+	if err := r.Replace("POST", "/users/:id", f3); err == nil {
+		t.Error("expected missing route error")
+	}
+
+	if err := r.Remove("GET", "/users/:name/posts"); err == nil {
+		t.Error("expected missing route error for wrong parameter name")
+	}
+	if err := r.Remove("GET", "/users/:id/posts"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, r, "GET", "/users/1/posts", 0)
+	expect(t, r, "GET", "/users/1", 3)
+	if len(r.root.Load().children["users"].children[any].children) != 0 {
+		t.Error("expected empty node to be pruned")
+	}
+	if err := r.Remove("GET", "/users/:id"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.root.Load().children) != 0 {
+		t.Error("expected empty trie")
+	}
+}
+
+func expect(t *testing.T, r *Router, method, path string, id int) {
+	t.Helper()
+	handlerId = 0
+	r.ServeHTTP(fakeResp{}, makeRequest(method, path))
+	if handlerId != id {
+		t.Errorf("%v %v expected %v, got %v", method, path, id, handlerId)
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	r := NewRouter("")
+	r.Get("/", func(*Env) {})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				path := fmt.Sprintf("/g%v/r%v/:id", i, j)
+				if err := r.Add("GET", path, func(*Env) {}); err != nil {
+					t.Error(err)
+				}
+				r.ServeHTTP(fakeResp{}, makeRequest("GET", fmt.Sprintf("/g%v/r%v/1", i, j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(r.Routes()); n != 201 {
+		t.Errorf("expected 201 routes, got %v", n)
+	}
+}
@@ -0,0 +1,63 @@
+package r2
+
+import "strings"
+
+// Group registers routes under a common path prefix, applying its options
+// to each route before the route's own.
+type Group struct {
+	router *Router
+	prefix string
+	opts   []Option
+}
+
+// Group returns a group of routes under prefix.
+func (r *Router) Group(prefix string, opts ...Option) *Group {
+	return &Group{r, strings.TrimSuffix(prefix, "/"), opts}
+}
+
+// Group returns a group nested in g, with the options of both.
+func (g *Group) Group(prefix string, opts ...Option) *Group {
+	return &Group{g.router, g.prefix + strings.TrimSuffix(prefix, "/"), g.options(opts)}
+}
+
+// Use adds middleware to every route registered in the group from now on.
+func (g *Group) Use(mw ...Middleware) {
+	g.opts = append(g.opts, With(mw...))
+}
+
+func (g *Group) options(opts []Option) []Option {
+	return append(append([]Option(nil), g.opts...), opts...)
+}
+
+func (g *Group) path(path string) string {
+	if path == "/" && g.prefix != "" {
+		return g.prefix
+	}
+	return g.prefix + path
+}
+
+func (g *Group) Route(method, path string, handler Handler, opts ...Option) {
+	g.router.route(g.path(path), handler, method, g.options(opts))
+}
+
+// Handle registers a pattern in ServeMux syntax, as Router.Handle does.
+func (g *Group) Handle(pattern string, handler Handler, opts ...Option) {
+	method, path := splitMuxPattern(pattern)
+	g.router.route(g.path(path), handler, method, g.options(opts))
+}
+
+func (g *Group) Get(path string, handler Handler, opts ...Option) {
+	g.Route("GET", path, handler, opts...)
+}
+func (g *Group) Post(path string, handler Handler, opts ...Option) {
+	g.Route("POST", path, handler, opts...)
+}
+func (g *Group) Put(path string, handler Handler, opts ...Option) {
+	g.Route("PUT", path, handler, opts...)
+}
+func (g *Group) Delete(path string, handler Handler, opts ...Option) {
+	g.Route("DELETE", path, handler, opts...)
+}
+func (g *Group) Patch(path string, handler Handler, opts ...Option) {
+	g.Route("PATCH", path, handler, opts...)
+}
@@ -0,0 +1,45 @@
+package r2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(e *Env) {
+				trace = append(trace, name)
+				next(e)
+			}
+		}
+	}
+	r := NewRouter("")
+	api := r.Group("/api/", Tags("api"), With(mark("api")))
+	api.Get("/", f4)
+	v1 := api.Group("/v1")
+	v1.Use(mark("v1"))
+	v1.Get("/users/:id", f4, Name("user"), With(mark("route")))
+	v1.Handle("DELETE /users/{id}", f4)
+
+	for _, c := range []struct{ method, path, pattern string }{
+		{"GET", "/api", "/api"},
+		{"GET", "/api/v1/users/1", "/api/v1/users/:id"},
+		{"DELETE", "/api/v1/users/1", "/api/v1/users/{id}"},
+	} {
+		matched = nil
+		serve(r, c.method, c.path)
+		if got := matched; got == nil || got.Pattern != c.pattern || got.Tags[0] != "api" {
+			t.Errorf("%v %v matched %+v", c.method, c.path, got)
+		}
+	}
+	trace = nil
+	serve(r, "GET", "/api/v1/users/1")
+	if got := strings.Join(trace, " "); got != "api v1 route" {
+		t.Errorf("unexpected middleware %v", got)
+	}
+	if r.Named("user") == nil {
+		t.Error("missing named route")
+	}
+}
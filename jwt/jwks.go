@@ -0,0 +1,186 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// JWKS is a KeySet read from a JSON Web Key Set document. When a token
+// names a key it doesn't have, the document is read again, so keys can be
+// rotated without a restart.
+type JWKS struct {
+	source func() ([]byte, error)
+	// MinRefresh is the least time between reads of the document, so that
+	// tokens with unknown keys can't force a read for each request.
+	MinRefresh time.Duration
+
+	mu   sync.Mutex
+	keys map[string]jwk
+	read time.Time
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// symmetric
+	K string `json:"k"`
+
+	key interface{}
+}
+
+// NewJWKS returns a key set read from source, reading it now.
+func NewJWKS(source func() ([]byte, error)) (*JWKS, error) {
+	s := &JWKS{source: source, MinRefresh: time.Minute}
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// File reads a JWKS document from a file.
+func File(path string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// URL fetches a JWKS document over HTTP.
+func URL(url string) func() ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func() ([]byte, error) {
+		res, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %v: %v", url, res.Status)
+		}
+		return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	}
+}
+
+// Refresh reads the document again, keeping the current keys on error.
+// Keys of unsupported types or not for signing are skipped; it is an error
+// only if none is left.
+func (s *JWKS) Refresh() error {
+	s.mu.Lock()
+	s.read = time.Now()
+	s.mu.Unlock()
+
+	// read without the lock, so verification goes on meanwhile
+	b, err := s.source()
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	keys := map[string]jwk{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.key, err = k.parse(); err != nil {
+			continue
+		}
+		keys[k.Kid] = k
+	}
+	if len(keys) == 0 {
+		return errors.New("jwt: no usable keys in JWKS")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	return nil
+}
+
+func (s *JWKS) Key(kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	k, found := s.keys[kid]
+	stale := !found && time.Since(s.read) >= s.MinRefresh
+	s.mu.Unlock()
+
+	if stale {
+		if err := s.Refresh(); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		k, found = s.keys[kid]
+		s.mu.Unlock()
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if k.Alg != "" && k.Alg != alg {
+		return nil, fmt.Errorf("key %q is for %v, not %v", kid, k.Alg, alg)
+	}
+	return k.key, nil
+}
+
+func (k *jwk) parse() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := number(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := number(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent %q", k.E)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %v", k.Crv)
+		}
+		x, err := number(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := number(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point not on curve")
+		}
+		return key, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func number(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
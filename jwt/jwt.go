@@ -0,0 +1,222 @@
+// Package jwt verifies JSON Web Tokens sent as bearer tokens to an r2
+// Router, signed with HS256, RS256 or ES256, with keys that may come from
+// a rotating JWKS document.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aver-d/r2"
+	"github.com/aver-d/r2/auth"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid signature")
+	ErrExpired   = errors.New("token expired")
+	ErrNotYet    = errors.New("token not valid yet")
+)
+
+// KeySet finds the key verifying tokens with the given key ID and
+// algorithm: a []byte for HS256, an *rsa.PublicKey for RS256 and an
+// *ecdsa.PublicKey for ES256.
+type KeySet interface {
+	Key(kid, alg string) (interface{}, error)
+}
+
+// Secret is the key of tokens signed with HS256.
+type Secret []byte
+
+func (s Secret) Key(kid, alg string) (interface{}, error) {
+	return []byte(s), nil
+}
+
+type Verifier struct {
+	Keys KeySet
+	// if set, the iss claim must equal Issuer
+	Issuer string
+	// if set, the aud claim must contain Audience
+	Audience string
+	// Leeway allows for clock skew when checking exp and nbf.
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+func New(keys KeySet) *Verifier {
+	return &Verifier{Keys: keys}
+}
+
+// Middleware authenticates bearer tokens, setting Env.Principal with the
+// sub claim as its name and the token's claims, and then checks the scopes
+// the route requires in its metadata, as auth.RouteScopes does.
+func (v *Verifier) Middleware(realm string) r2.Middleware {
+	bearer := auth.Bearer(realm, v.Verify)
+	return func(next r2.Handler) r2.Handler {
+		return bearer(auth.RouteScopes(next))
+	}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature and claims of a token, returning its
+// principal. Scopes are read from a space-separated scope claim or a scp
+// array.
+func (v *Verifier) Verify(token string) (*r2.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	key, err := v.Keys.Key(h.Kid, h.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decode(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.check(claims); err != nil {
+		return nil, err
+	}
+	p := &r2.Principal{Scheme: "Bearer", Claims: claims}
+	p.Name, _ = claims["sub"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	}
+	p.Scopes = append(p.Scopes, strings.Fields(strings.Join(strs(claims["scp"]), " "))...)
+	return p, nil
+}
+
+func decode(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+func verify(alg string, key interface{}, input string, sig []byte) error {
+	sum := sha256.Sum256([]byte(input))
+	ok := false
+	// the key's type must suit the algorithm, or an RSA public key could
+	// pass as an HMAC secret
+	switch k := key.(type) {
+	case []byte:
+		if alg == "HS256" {
+			mac := hmac.New(sha256.New, k)
+			mac.Write([]byte(input))
+			ok = hmac.Equal(sig, mac.Sum(nil))
+		}
+	case *rsa.PublicKey:
+		if alg == "RS256" {
+			ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == "ES256" && len(sig) == 64 {
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			ok = ecdsa.Verify(k, sum[:], r, s)
+		}
+	default:
+		return fmt.Errorf("unsupported key %T", key)
+	}
+	if !ok {
+		return ErrSignature
+	}
+	return nil
+}
+
+func (v *Verifier) check(claims map[string]interface{}) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	exp, hasExp, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if hasExp && now.After(exp.Add(v.Leeway)) {
+		return ErrExpired
+	}
+	nbf, hasNbf, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if hasNbf && now.Add(v.Leeway).Before(nbf) {
+		return ErrNotYet
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if v.Audience != "" {
+		aud := strs(claims["aud"])
+		if s, ok := claims["aud"].(string); ok {
+			aud = []string{s}
+		}
+		found := false
+		for _, a := range aud {
+			found = found || a == v.Audience
+		}
+		if !found {
+			return fmt.Errorf("token not for audience %v", v.Audience)
+		}
+	}
+	return nil
+}
+
+// numericDate returns a time claim, which must be a JSON number if present.
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, found := claims[name]
+	if !found {
+		return time.Time{}, false, nil
+	}
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false, ErrMalformed
+	}
+	return unix(seconds), true, nil
+}
+
+func unix(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// strs returns the strings of a JSON array.
+func strs(v interface{}) []string {
+	a, _ := v.([]interface{})
+	var s []string
+	for _, e := range a {
+		if str, ok := e.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
@@ -0,0 +1,227 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aver-d/r2"
+	"github.com/aver-d/r2/auth"
+)
+
+var b64 = base64.RawURLEncoding
+
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	sum := sha256.Sum256([]byte(input))
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		r, s, e := ecdsa.Sign(rand.Reader, k, sum[:])
+		sig, err = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), e
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + b64.EncodeToString(sig)
+}
+
+func jwks(keys ...interface{}) []byte {
+	var doc []map[string]string
+	for i, key := range keys {
+		kid := fmt.Sprint("k", i)
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			doc = append(doc, map[string]string{"kty": "RSA", "kid": kid, "alg": "RS256",
+				"n": b64.EncodeToString(k.N.Bytes()), "e": b64.EncodeToString([]byte{1, 0, 1})})
+		case *ecdsa.PrivateKey:
+			doc = append(doc, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": b64.EncodeToString(k.X.Bytes()), "y": b64.EncodeToString(k.Y.Bytes())})
+		}
+	}
+	b, _ := json.Marshal(map[string]interface{}{"keys": doc})
+	return b
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, jwks(rsaKey, ecKey), 0600)
+	keys, err := NewJWKS(File(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	v := New(keys)
+	v.Issuer, v.Audience, v.Leeway = "https://issuer", "api", time.Minute
+	v.now = func() time.Time { return now }
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "ann", "iss": "https://issuer", "aud": []string{"web", "api"},
+			"exp": now.Unix() + 60, "scope": "read write"}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"RS256", sign(t, "RS256", "k0", rsaKey, claims(nil)), ""},
+		{"ES256", sign(t, "ES256", "k1", ecKey, claims(nil)), ""},
+		{"wrong key", sign(t, "RS256", "k1", rsaKey, claims(nil)), "invalid signature"},
+		{"algorithm of key", sign(t, "ES256", "k0", ecKey, claims(nil)), "key \"k0\" is for RS256, not ES256"},
+		{"HS256 with public key", sign(t, "HS256", "k1", []byte("x"), claims(nil)), "invalid signature"},
+		{"unknown key", sign(t, "RS256", "k9", rsaKey, claims(nil)), "unknown key \"k9\""},
+		{"expired", sign(t, "RS256", "k0", rsaKey, claims(map[string]interface{}{"exp": now.Unix() - 120})), "token expired"},
+		{"within leeway", sign(t, "RS256", "k0", rsaKey, claims(map[string]interface{}{"exp": now.Unix() - 30})), ""},
+		{"not yet", sign(t, "RS256", "k0", rsaKey, claims(map[string]interface{}{"nbf": now.Unix() + 120})), "token not valid yet"},
+		{"issuer", sign(t, "RS256", "k0", rsaKey, claims(map[string]interface{}{"iss": "other"})), "unexpected issuer other"},
+		{"audience", sign(t, "RS256", "k0", rsaKey, claims(map[string]interface{}{"aud": "web"})), "token not for audience api"},
+		{"malformed", "abc.def", "malformed token"},
+	}
+	for _, c := range cases {
+		p, err := v.Verify(c.token)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%v: expected error %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", c.name, err)
+			continue
+		}
+		if p.Name != "ann" || p.Scheme != "Bearer" || !reflect.DeepEqual(p.Scopes, []string{"read", "write"}) || p.Claims["iss"] != "https://issuer" {
+			t.Errorf("%v: unexpected principal %+v", c.name, p)
+		}
+	}
+
+	token := sign(t, "RS256", "k0", rsaKey, claims(nil))
+	tampered := token[:len(token)-4] + "AAAA"
+	if _, err := v.Verify(tampered); err != ErrSignature {
+		t.Errorf("tampered token: %v", err)
+	}
+}
+
+func TestHS256(t *testing.T) {
+	v := New(Secret("secret"))
+	p, err := v.Verify(sign(t, "HS256", "", []byte("secret"), map[string]interface{}{"sub": "bob", "scp": []string{"admin"}}))
+	if err != nil || p.Name != "bob" || !p.HasScope("admin") {
+		t.Errorf("unexpected result %+v %v", p, err)
+	}
+	if _, err := v.Verify(sign(t, "HS256", "", []byte("guess"), nil)); err != ErrSignature {
+		t.Errorf("wrong secret: %v", err)
+	}
+	if _, err := v.Verify(b64.EncodeToString([]byte(`{"alg":"none"}`)) + ".e30."); err == nil {
+		t.Error("unsigned token accepted")
+	}
+	for _, claim := range []string{"exp", "nbf"} {
+		for _, value := range []interface{}{"1", nil, true} {
+			token := sign(t, "HS256", "", []byte("secret"), map[string]interface{}{"sub": "bob", claim: value})
+			if _, err := v.Verify(token); err != ErrMalformed {
+				t.Errorf("%v %#v: expected malformed, got %v", claim, value, err)
+			}
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	next, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var doc atomic.Value
+	doc.Store(jwks(old))
+	var reads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads.Add(1)
+		w.Write(doc.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	keys, err := NewJWKS(URL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.MinRefresh = 0
+	v := New(keys)
+
+	r := r2.NewRouter("")
+	r.Use(v.Middleware("api"))
+	r.Get("/admin", func(e *r2.Env) { e.Text(200, e.Principal.Name) }, r2.Meta(auth.MetaScopes, "admin"))
+	get := func(token string) int {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	admin := map[string]interface{}{"sub": "ann", "scope": "admin"}
+	if code := get(sign(t, "ES256", "k0", old, admin)); code != 200 {
+		t.Errorf("expected 200, got %v", code)
+	}
+	if code := get(sign(t, "ES256", "k0", old, map[string]interface{}{"sub": "bob"})); code != 403 {
+		t.Errorf("missing scope: expected 403, got %v", code)
+	}
+	// the new key replaces the old one, as k1
+	doc.Store(jwks(nil, next))
+	if code := get(sign(t, "ES256", "k1", next, admin)); code != 200 {
+		t.Errorf("rotated key: expected 200, got %v", code)
+	}
+	if code := get(sign(t, "ES256", "k0", old, admin)); code != 401 {
+		t.Errorf("retired key: expected 401, got %v", code)
+	}
+	if reads.Load() != 3 {
+		t.Errorf("expected 3 reads, got %v", reads.Load())
+	}
+}
+
+func TestJWKSSkipsUnusableKeys(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var doc map[string][]map[string]string
+	json.Unmarshal(jwks(ecKey), &doc)
+	doc["keys"] = append(doc["keys"],
+		map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AAAA"},
+		map[string]string{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AAAA", "y": "AAAA"},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	)
+	b, _ := json.Marshal(doc)
+	keys, err := NewJWKS(func() ([]byte, error) { return b, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(keys).Verify(sign(t, "ES256", "k0", ecKey, map[string]interface{}{"sub": "ann"})); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewJWKS(func() ([]byte, error) { return []byte(`{"keys": [{"kty": "OKP"}]}`), nil }); err == nil {
+		t.Error("expected error for a set with no usable keys")
+	}
+}
@@ -0,0 +1,291 @@
+package r2
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "error"
+}
+
+// Issue is a problem found by Lint. Check names the kind of problem:
+// "prefix", "shadowed", "constraint", "slash", "typo", "duplicate", "name"
+// or "cors".
+type Issue struct {
+	Severity Severity
+	Check    string
+	Pattern  string
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%v: %v: %v: %v", i.Severity, i.Check, i.Pattern, i.Message)
+}
+
+type Issues []Issue
+
+// AtLeast returns the issues of severity s or higher.
+func (is Issues) AtLeast(s Severity) Issues {
+	var found Issues
+	for _, i := range is {
+		if i.Severity >= s {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// Err returns an error listing the issues of severity s or higher, or nil
+// if there are none, e.g. for failing a test:
+//
+//	if err := router.Lint().Err(r2.SeverityWarning); err != nil {
+//		t.Fatal(err)
+//	}
+func (is Issues) Err(s Severity) error {
+	found := is.AtLeast(s)
+	if len(found) == 0 {
+		return nil
+	}
+	lines := make([]string, len(found))
+	for n, i := range found {
+		lines[n] = i.String()
+	}
+	return errors.New("r2: lint:\n" + strings.Join(lines, "\n"))
+}
+
+// Lint reports every problem found in the routes at once, ordered by
+// severity and then pattern. Registration already rejects conflicting
+// parameters and duplicate routes, so these are the problems it allows.
+func (r *Router) Lint() Issues {
+	var issues Issues
+	add := func(s Severity, check, pattern, format string, args ...interface{}) {
+		issues = append(issues, Issue{s, check, pattern, fmt.Sprintf(format, args...)})
+	}
+
+	if r.prefix != "" && !strings.HasPrefix(r.prefix, "/") {
+		add(SeverityError, "prefix", r.prefix, "prefix does not start with /, so no request can match")
+	}
+
+	lintCORS(r.CORS, "", add)
+
+	root := r.root.Load()
+	walkPaths(root, "", func(node *trieNode, path string) {
+		lintNode(node, path, add)
+	})
+
+	handlers := map[uintptr][]*Route{}
+	names := map[string]*Route{}
+	for _, route := range r.Routes() {
+		if first, found := names[route.Name]; found && route.Name != "" {
+			add(SeverityWarning, "name", route.Pattern, "name %q is also used by %v %v", route.Name, first.Method, first.Pattern)
+		} else {
+			names[route.Name] = route
+		}
+		lintConstraints(root, route, add)
+		lintSlashes(route, add)
+		lintCORS(route.cors, route.Pattern, add)
+		ptr := funcPointer(route.Handler)
+		handlers[ptr] = append(handlers[ptr], route)
+	}
+	for _, routes := range handlers {
+		if len(routes) > 1 {
+			add(SeverityInfo, "duplicate", routes[0].Pattern, "handler %v also serves %v other routes",
+				routes[0].HandlerName, len(routes)-1)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Severity != issues[j].Severity {
+			return issues[i].Severity > issues[j].Severity
+		}
+		return issues[i].Pattern < issues[j].Pattern
+	})
+	return issues
+}
+
+// walkPaths calls fn with every node and its path, parameters written as
+// :name and wildcards as {name...}.
+func walkPaths(node *trieNode, path string, fn func(*trieNode, string)) {
+	fn(node, path)
+	for _, part := range sortedParts(node) {
+		walkPaths(node.children[part], path+"/"+label(part, node.children[part]), fn)
+	}
+}
+
+func label(part string, node *trieNode) string {
+	switch part {
+	case any:
+		return ":" + node.paramName
+	case wildcard:
+		return "{" + node.paramName + "...}"
+	}
+	return part
+}
+
+func lintNode(node *trieNode, path string, add func(Severity, string, string, string, ...interface{})) {
+	param, hasParam := node.children[any]
+	_, hasWildcard := node.children[wildcard]
+
+	var statics []string
+	for _, part := range sortedParts(node) {
+		if part != any && part != wildcard {
+			statics = append(statics, part)
+		}
+	}
+
+	// static parts win over parameters and lookups only fall back to a
+	// wildcard, so routes below a parameter can't be reached with a static sibling's name
+	if hasParam && hasRoutesBelow(param) {
+		var shadowing []string
+		for _, s := range statics {
+			if param.paramRe == nil || param.paramRe.MatchString(s) {
+				shadowing = append(shadowing, strconv.Quote(s))
+			}
+		}
+		if len(shadowing) > 0 {
+			add(SeverityWarning, "shadowed", path+"/:"+param.paramName,
+				"requests with %v %v take the static route instead", param.paramName, strings.Join(shadowing, " or "))
+		}
+	}
+	if hasParam && hasWildcard {
+		add(SeverityWarning, "shadowed", path+"/"+label(wildcard, node.children[wildcard]),
+			"requests whose next part matches :%v don't reach the wildcard", param.paramName)
+	}
+
+	// a path matched below a static part is answered there, with 405 for
+	// other methods, where ServeMux would try the wildcard
+	if hasWildcard {
+		for _, s := range statics {
+			if hasRoutesBelow(node.children[s]) {
+				add(SeverityWarning, "shadowed", path+"/"+label(wildcard, node.children[wildcard]),
+					"requests for routes below %q with other methods get 405 rather than the wildcard", s)
+			}
+		}
+	}
+
+	for i, a := range statics {
+		for _, b := range statics[i+1:] {
+			if len(a) >= 4 && len(b) >= 4 && distance(strings.ToLower(a), strings.ToLower(b)) <= 1 {
+				add(SeverityInfo, "typo", path+"/"+b, "%q and %q differ by one edit", a, b)
+			}
+		}
+	}
+}
+
+func hasRoutesBelow(node *trieNode) bool {
+	found := len(node.handlers) > 0
+	walk(node, func(n *trieNode) {
+		found = found || len(n.handlers) > 0
+	})
+	return found
+}
+
+// lintConstraints finds parameters whose regex is ignored because the
+// parameter was first registered with a different one.
+func lintConstraints(root *trieNode, route *Route, add func(Severity, string, string, string, ...interface{})) {
+	node := root
+	params := route.Params
+	for _, part := range split(route.Pattern) {
+		key := part
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "{") && part != exact {
+			key = any
+			if strings.HasSuffix(part, "...}") {
+				key = wildcard
+			}
+		}
+		next, found := node.children[key]
+		if !found {
+			return
+		}
+		if key == any && len(params) > 0 {
+			param := params[0]
+			params = params[1:]
+			if param.Regexp != next.paramRe {
+				add(SeverityError, "constraint", route.Pattern, "constraint of :%v is ignored, as %v was registered first",
+					param.Name, describe(next))
+			}
+		}
+		node = next
+	}
+}
+
+func describe(param *trieNode) string {
+	if param.paramRe == nil {
+		return "an unconstrained :" + param.paramName
+	}
+	return ":" + param.paramName + " matching " + param.paramRe.String()
+}
+
+// lintSlashes finds patterns written with slashes that lookups treat
+// differently from registration.
+func lintSlashes(route *Route, add func(Severity, string, string, string, ...interface{})) {
+	p := route.Pattern
+	if p == "/" {
+		return
+	}
+	normal := "/" + strings.Trim(p, "/")
+	switch {
+	case strings.HasPrefix(p, "//") || strings.HasSuffix(p, "//"):
+		add(SeverityWarning, "slash", p, "requests for the path as written are not found, as their empty parts are kept; the route matches %v", normal)
+	case !strings.HasPrefix(p, "/"):
+		add(SeverityInfo, "slash", p, "missing leading slash is added; the route matches %v", normal)
+	case strings.HasSuffix(p, "/"):
+		add(SeverityInfo, "slash", p, "trailing slash is ignored; the route also matches %v", normal)
+	}
+	if strings.Contains(strings.Trim(p, "/"), "//") {
+		add(SeverityWarning, "slash", p, "empty part only matches requests with the same empty part")
+	}
+}
+
+// distance is the edit distance between a and b, counting a transposition
+// of adjacent characters as one edit.
+func distance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// lintCORS reports a configuration allowing credentials from any origin,
+// which CORS ignores.
+func lintCORS(c *CORS, pattern string, add func(Severity, string, string, string, ...interface{})) {
+	if c != nil && c.Credentials && slices.Contains(c.Origins, "*") {
+		add(SeverityError, "cors", pattern, `origin "*" is ignored with credentials; list the trusted origins`)
+	}
+}
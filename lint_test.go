@@ -0,0 +1,49 @@
+package r2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	r := NewRouter("api")
+	r.Get("/users/:id!int/posts", f1)
+	r.Get("/users/new", f2)
+	r.Get("/users/:id![a-z]+", f1)
+	r.Get("/items/:name/x", f1)
+	r.Get("/items/all", f1)
+	r.Get("/repos/", f3)
+	r.Get("/repo//", f3)
+	r.Get("/teams", f3)
+	r.Get("/taems", f3)
+	r.Handle("/docs/{page...}", f4)
+	r.Get("/docs/intro/x", func(e *Env) {})
+
+	issues := r.Lint()
+	expected := []string{
+		`error: constraint: /users/:id![a-z]+: constraint of :id is ignored, as :id matching ^-?\d+$ was registered first`,
+		"error: prefix: api: prefix does not start with /, so no request can match",
+		`warning: shadowed: /docs/{page...}: requests for routes below "intro" with other methods get 405 rather than the wildcard`,
+		`warning: shadowed: /items/:name: requests with name "all" take the static route instead`,
+		"warning: slash: /repo//: requests for the path as written are not found, as their empty parts are kept; the route matches /repo",
+		"info: duplicate: /items/:name/x: handler f1 also serves 3 other routes",
+		"info: duplicate: /repo//: handler f3 also serves 3 other routes",
+		`info: typo: /repos: "repo" and "repos" differ by one edit`,
+		"info: slash: /repos/: trailing slash is ignored; the route also matches /repos",
+		`info: typo: /teams: "taems" and "teams" differ by one edit`,
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %v issues, got\n%v", len(expected), issues.Err(SeverityInfo))
+	}
+	for n, issue := range issues {
+		if issue.String() != expected[n] {
+			t.Errorf("expected\n%v\ngot\n%v", expected[n], issue)
+		}
+	}
+	if err := issues.Err(SeverityWarning); err == nil || strings.Count(err.Error(), "\n") != 5 {
+		t.Errorf("expected five issues, got %v", err)
+	}
+	if err := newRouter(simpleAPI).Lint().Err(SeverityError); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,265 @@
+// Package metrics records requests dispatched by an r2 Router and exposes
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aver-d/r2"
+)
+
+var (
+	// DefaultBuckets are upper bounds of request durations, in seconds.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are upper bounds of response sizes, in bytes.
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+)
+
+// Metrics records, by method, route pattern and status:
+//
+//	<namespace>_requests_total             counter
+//	<namespace>_request_duration_seconds   histogram
+//	<namespace>_response_size_bytes        histogram
+//
+// and by method and route pattern:
+//
+//	<namespace>_requests_in_flight         gauge
+type Metrics struct {
+	Namespace   string
+	Buckets     []float64
+	SizeBuckets []float64
+
+	mu       sync.Mutex
+	series   map[labels]*series
+	inFlight map[labels]int64
+}
+
+type labels struct {
+	method, route, status string
+}
+
+type series struct {
+	durations histogram
+	sizes     histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds))
+	}
+	for i, bound := range bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func New() *Metrics {
+	return &Metrics{
+		Namespace:   "http",
+		Buckets:     DefaultBuckets,
+		SizeBuckets: DefaultSizeBuckets,
+		series:      map[labels]*series{},
+		inFlight:    map[labels]int64{},
+	}
+}
+
+// Register records every route of the router and serves the metrics at path.
+func (m *Metrics) Register(r *r2.Router, path string) {
+	r.Use(m.Middleware)
+	r.Get(path, m.Handler)
+}
+
+// Middleware records the requests passing through it.
+func (m *Metrics) Middleware(next r2.Handler) r2.Handler {
+	return func(env *r2.Env) {
+		route, method := env.Route.Pattern, methodLabel(env.R.Method)
+		flight := labels{method, route, ""}
+		m.mu.Lock()
+		m.inFlight[flight]++
+		m.mu.Unlock()
+
+		start := time.Now()
+		defer func() {
+			elapsed := time.Since(start).Seconds()
+			status := env.Status()
+			// a panic is recorded as the 500 that PanicHandler, run later,
+			// is expected to answer, and then carried on
+			v := recover()
+			if v != nil {
+				status = http.StatusInternalServerError
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+			m.observe(flight, labels{method, route, strconv.Itoa(status)}, elapsed, env.Written())
+			if v != nil {
+				panic(v)
+			}
+		}()
+		next(env)
+	}
+}
+
+func (m *Metrics) observe(flight, key labels, elapsed float64, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[flight]--
+	s, found := m.series[key]
+	if !found {
+		s = &series{}
+		m.series[key] = s
+	}
+	s.durations.observe(m.Buckets, elapsed)
+	s.sizes.observe(m.SizeBuckets, float64(size))
+}
+
+var methods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+	http.MethodConnect: true, http.MethodTrace: true,
+}
+
+// methodLabel returns "other" for methods outside the standard set, so that
+// clients of routes matching any method can't add series at will.
+func methodLabel(method string) string {
+	if methods[method] {
+		return method
+	}
+	return "other"
+}
+
+// Handler writes the metrics.
+func (m *Metrics) Handler(env *r2.Env) {
+	env.W.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(env.W)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := &countingWriter{w: bufio.NewWriter(w)}
+	keys := make([]labels, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sortLabels(keys)
+
+	name := m.Namespace + "_requests_total"
+	header(b, name, "counter", "Requests handled, by method, route and status.")
+	for _, key := range keys {
+		fmt.Fprintf(b, "%v{%v} %v\n", name, key, m.series[key].durations.count)
+	}
+
+	name = m.Namespace + "_request_duration_seconds"
+	header(b, name, "histogram", "Time taken to handle requests.")
+	for _, key := range keys {
+		writeHistogram(b, name, key, m.Buckets, &m.series[key].durations)
+	}
+
+	name = m.Namespace + "_response_size_bytes"
+	header(b, name, "histogram", "Size of response bodies.")
+	for _, key := range keys {
+		writeHistogram(b, name, key, m.SizeBuckets, &m.series[key].sizes)
+	}
+
+	flights := make([]labels, 0, len(m.inFlight))
+	for key := range m.inFlight {
+		flights = append(flights, key)
+	}
+	sortLabels(flights)
+	name = m.Namespace + "_requests_in_flight"
+	header(b, name, "gauge", "Requests being handled.")
+	for _, key := range flights {
+		fmt.Fprintf(b, "%v{%v} %v\n", name, key, m.inFlight[key])
+	}
+
+	if err := b.w.(*bufio.Writer).Flush(); err != nil {
+		return b.n, err
+	}
+	return b.n, b.err
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, kind)
+}
+
+func writeHistogram(w io.Writer, name string, key labels, bounds []float64, h *histogram) {
+	for i, bound := range bounds {
+		var n uint64
+		if h.counts != nil {
+			n = h.counts[i]
+		}
+		fmt.Fprintf(w, "%v_bucket{%v,le=\"%v\"} %v\n", name, key, formatFloat(bound), n)
+	}
+	fmt.Fprintf(w, "%v_bucket{%v,le=\"+Inf\"} %v\n", name, key, h.count)
+	fmt.Fprintf(w, "%v_sum{%v} %v\n", name, key, formatFloat(h.sum))
+	fmt.Fprintf(w, "%v_count{%v} %v\n", name, key, h.count)
+}
+
+func (l labels) String() string {
+	s := fmt.Sprintf(`method="%v",route="%v"`, escape(l.method), escape(l.route))
+	if l.status != "" {
+		s += fmt.Sprintf(`,status="%v"`, l.status)
+	}
+	return s
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortLabels(keys []labels) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aver-d/r2"
+)
+
+func TestMetrics(t *testing.T) {
+	r := r2.NewRouter("")
+	m := New()
+	m.Register(r, "/metrics")
+	r.Get("/users/:id", func(e *r2.Env) { e.Text(200, "hello") })
+	r.Post("/users", func(e *r2.Env) { e.Error(400, nil) })
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	for _, line := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`http_requests_total{method="POST",route="/users",status="400"} 1`,
+		`http_response_size_bytes_bucket{method="GET",route="/users/:id",status="200",le="100"} 2`,
+		`http_response_size_bytes_sum{method="GET",route="/users/:id",status="200"} 10`,
+		`http_request_duration_seconds_count{method="POST",route="/users",status="400"} 1`,
+		`http_request_duration_seconds_bucket{method="POST",route="/users",status="400",le="+Inf"} 1`,
+		// the scrape itself is in flight
+		`http_requests_in_flight{method="GET",route="/metrics"} 1`,
+		`http_requests_in_flight{method="GET",route="/users/:id"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %v in\n%v", line, body)
+		}
+	}
+	if strings.Contains(body, "/missing") {
+		t.Error("unexpected metrics for unmatched path")
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	r := r2.NewRouter("")
+	m := New()
+	m.Register(r, "/metrics")
+	r.Handle("/any", func(e *r2.Env) {})
+	for _, method := range []string{"GET", "BREW", "WHEN"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/any", nil))
+	}
+	var b strings.Builder
+	m.WriteTo(&b)
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/any",status="200"} 1`,
+		`http_requests_total{method="other",route="/any",status="200"} 2`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %v in\n%v", line, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "BREW") {
+		t.Error("unexpected label for non-standard method")
+	}
+}
+
+func TestPanic(t *testing.T) {
+	r := r2.NewRouter("")
+	r.PanicHandler = func(e *r2.Env, v interface{}) { e.Error(500, nil) }
+	m := New()
+	m.Register(r, "/metrics")
+	r.Get("/boom", func(e *r2.Env) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/boom", nil))
+	if w.Code != 500 {
+		t.Fatalf("expected 500, got %v", w.Code)
+	}
+	var b strings.Builder
+	m.WriteTo(&b)
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/boom",status="500"} 1`,
+		`http_requests_in_flight{method="GET",route="/boom"} 0`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %v in\n%v", line, b.String())
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package r2
+
+// Middleware wraps a handler, doing work before or after calling it.
+type Middleware func(Handler) Handler
+
+// Use adds middleware run for every route, in the order given, around any
+// middleware of the route itself. Requests not matching a route, answered
+// with 404 or 405, don't pass through middleware.
+func (r *Router) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, mw...)
+	r.compiled.Store(nil)
+}
+
+// With adds middleware to a route, run inside the router's middleware.
+func With(mw ...Middleware) Option {
+	return func(route *Route) {
+		route.middleware = append(route.middleware, mw...)
+	}
+}
+
+// target is a route with its middleware applied.
+type target struct {
+	route   *Route
+	handler Handler
+}
+
+// chain wraps the handler of route in its middleware and then the router's.
+// Validation against the route's Spec happens just before the handler.
+func (r *Router) chain(route *Route) *target {
+	h := route.Handler
+	if route.spec != nil {
+		h = route.spec.wrap(h)
+	}
+	for i := len(route.middleware) - 1; i >= 0; i-- {
+		h = route.middleware[i](h)
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return &target{route, h}
+}
@@ -0,0 +1,33 @@
+package r2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(e *Env) {
+				trace = append(trace, name)
+				next(e)
+			}
+		}
+	}
+	r := NewRouter("")
+	r.Use(mark("a"))
+	r.Get("/x", func(*Env) { trace = append(trace, "h") }, With(mark("route")))
+	// added after routes, but still applies
+	r.Use(mark("b"))
+
+	serve(r, "GET", "/x")
+	if got := strings.Join(trace, " "); got != "a b route h" {
+		t.Errorf("unexpected order %v", got)
+	}
+	trace = nil
+	serve(r, "GET", "/missing")
+	if len(trace) != 0 {
+		t.Errorf("unexpected middleware for 404: %v", trace)
+	}
+}
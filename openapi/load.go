@@ -0,0 +1,193 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aver-d/r2"
+)
+
+// Report lists the mismatches between a spec and the handlers bound to it.
+type Report struct {
+	// operations without a bound handler, e.g. "GET /users/{id} (getUser)"
+	Unbound []string
+	// operationIds of handlers matching no operation
+	Unused []string
+}
+
+type Loader struct {
+	// Unmarshal decodes the spec into JSON compatible values. It defaults to
+	// json.Unmarshal; a YAML decoder producing map[string]interface{} values,
+	// such as the one in gopkg.in/yaml.v3, can be used for YAML specs.
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+// Load registers the operations in a JSON spec with the router.
+func Load(r *r2.Router, spec []byte, handlers map[string]r2.Handler) (*Report, error) {
+	return (&Loader{}).Load(r, spec, handlers)
+}
+
+// raw form of the spec, since path items hold parameters next to operations
+type rawSpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components *Components                           `json:"components"`
+}
+
+var methods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// operation is an operation of a spec ready to be added to a router.
+type operation struct {
+	id, method, path, pattern string
+	handler                   r2.Handler
+}
+
+// Load registers every operation in spec whose operationId is a key of
+// handlers, translating path templates with Pattern. If any operation can't
+// be registered, none are, and the router is left as it was.
+func (l *Loader) Load(r *r2.Router, spec []byte, handlers map[string]r2.Handler) (*Report, error) {
+	var doc rawSpec
+	if err := l.decode(spec, &doc); err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	used := map[string]bool{}
+	var ops []operation
+
+	for _, path := range sortedKeys(doc.Paths) {
+		item := doc.Paths[path]
+		var shared []*Parameter
+		if raw, found := item["parameters"]; found {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("openapi: parameters of %v: %v", path, err)
+			}
+		}
+		for _, method := range sortedKeys(item) {
+			if !methods[method] {
+				continue
+			}
+			var op Operation
+			if err := json.Unmarshal(item[method], &op); err != nil {
+				return nil, fmt.Errorf("openapi: %v %v: %v", method, path, err)
+			}
+			method = strings.ToUpper(method)
+			handler, found := handlers[op.OperationID]
+			if op.OperationID == "" || !found {
+				report.Unbound = append(report.Unbound, fmt.Sprintf("%v %v (%v)", method, path, op.OperationID))
+				continue
+			}
+			params := doc.Components.resolve(append(shared, op.Parameters...))
+			pattern, err := Pattern(path, params)
+			if err != nil {
+				return nil, fmt.Errorf("openapi: operation %v (%v %v): %w", op.OperationID, method, path, err)
+			}
+			ops = append(ops, operation{op.OperationID, method, path, pattern, handler})
+			used[op.OperationID] = true
+		}
+	}
+	for i, op := range ops {
+		if err := r.Add(op.method, op.pattern, op.handler); err != nil {
+			for _, added := range ops[:i] {
+				r.Remove(added.method, added.pattern)
+			}
+			return nil, fmt.Errorf("openapi: operation %v (%v %v): %w", op.id, op.method, op.path, err)
+		}
+	}
+	for id := range handlers {
+		if !used[id] {
+			report.Unused = append(report.Unused, id)
+		}
+	}
+	sort.Strings(report.Unused)
+	return report, nil
+}
+
+func (l *Loader) decode(spec []byte, doc *rawSpec) error {
+	if l.Unmarshal == nil {
+		return json.Unmarshal(spec, doc)
+	}
+	var v interface{}
+	if err := l.Unmarshal(spec, &v); err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, doc)
+}
+
+// Pattern converts an OpenAPI path template to an r2 pattern, so "/users/{id}"
+// with an integer id parameter becomes "/users/:id!int". String parameters
+// with a schema pattern become regex constrained parameters.
+func Pattern(path string, params []*Parameter) (string, error) {
+	schemas := map[string]*Schema{}
+	for _, param := range params {
+		if param.In == "path" {
+			schemas[param.Name] = param.Schema
+		}
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			continue
+		}
+		name := part[1 : len(part)-1]
+		parts[i] = ":" + name
+		schema := schemas[name]
+		if schema == nil {
+			continue
+		}
+		switch {
+		case schema.Type == "integer":
+			parts[i] += "!int"
+		case schema.Type == "number":
+			parts[i] += "!float"
+		case schema.Pattern != "":
+			if strings.Contains(schema.Pattern, "/") {
+				return "", fmt.Errorf("openapi: pattern for %v in %v cannot contain /", name, path)
+			}
+			parts[i] += "!" + schema.Pattern
+		}
+	}
+	return "/" + strings.Join(parts, "/"), nil
+}
+
+// resolve replaces local references to parameters and their schemas.
+func (c *Components) resolve(params []*Parameter) []*Parameter {
+	if c == nil {
+		return params
+	}
+	resolved := make([]*Parameter, len(params))
+	for i, param := range params {
+		if ref := strings.TrimPrefix(param.Ref, "#/components/parameters/"); ref != param.Ref {
+			if p, found := c.Parameters[ref]; found {
+				param = p
+			}
+		}
+		if param.Schema != nil {
+			if ref := strings.TrimPrefix(param.Schema.Ref, "#/components/schemas/"); ref != param.Schema.Ref {
+				if s, found := c.Schemas[ref]; found {
+					withSchema := *param
+					withSchema.Schema = s
+					param = &withSchema
+				}
+			}
+		}
+		resolved[i] = param
+	}
+	return resolved
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
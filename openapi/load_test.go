@@ -0,0 +1,87 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aver-d/r2"
+)
+
+const spec = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/users/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {"operationId": "getUser"},
+      "delete": {"operationId": "deleteUser"}
+    },
+    "/files/{name}": {
+      "get": {
+        "operationId": "getFile",
+        "parameters": [{"name": "name", "in": "path", "schema": {"type": "string", "pattern": "[a-z]+"}}]
+      }
+    },
+    "/health": {"get": {}}
+  },
+  "components": {
+    "parameters": {"id": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}}
+  }
+}`
+
+func TestLoad(t *testing.T) {
+	var called string
+	handler := func(name string) r2.Handler {
+		return func(*r2.Env) { called = name }
+	}
+	r := r2.NewRouter("")
+	report, err := Load(r, []byte(spec), map[string]r2.Handler{
+		"getUser": handler("getUser"),
+		"getFile": handler("getFile"),
+		"listAll": handler("listAll"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Report{
+		Unbound: []string{"GET /health ()", "DELETE /users/{id} (deleteUser)"},
+		Unused:  []string{"listAll"},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+
+	for path, want := range map[string]string{
+		"/users/12": "getUser", "/users/x": "",
+		"/files/abc": "getFile", "/files/ABC": "",
+	} {
+		called = ""
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		if called != want {
+			t.Errorf("%v expected %q, got %q", path, want, called)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := map[string]string{
+		"bad pattern": `{"paths": {"/files/{name}": {"get": {"operationId": "getFile",
+			"parameters": [{"name": "name", "in": "path", "schema": {"pattern": "[a-z"}}]}}}}`,
+		"parameter conflict": `{"paths": {
+			"/files/{name}": {"get": {"operationId": "getFile"}},
+			"/files/{id}/raw": {"get": {"operationId": "getRaw"}}}}`,
+	}
+	for name, doc := range cases {
+		r := r2.NewRouter("")
+		h := func(*r2.Env) {}
+		_, err := Load(r, []byte(doc), map[string]r2.Handler{"getFile": h, "getRaw": h})
+		if err == nil || !strings.Contains(err.Error(), "operation getFile (GET /files/{name})") {
+			t.Errorf("%v: unexpected error %v", name, err)
+		}
+		if routes := r.Routes(); len(routes) != 0 {
+			t.Errorf("%v: routes left registered %v", name, routes)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Package openapi generates OpenAPI 3 documents from the routes of an r2 Router.
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aver-d/r2"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas,omitempty"`
+	Parameters map[string]*Parameter `json:"parameters,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem maps lower case http methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Ref         string  `json:"$ref,omitempty"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+// JSONRequest sets a required request body with the given schema.
+func (op *Operation) JSONRequest(schema *Schema) {
+	op.RequestBody = &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{"application/json": {schema}},
+	}
+}
+
+// JSONResponse adds a response for status, e.g. "200", with an optional schema.
+func (op *Operation) JSONResponse(status, description string, schema *Schema) {
+	res := &Response{Description: description}
+	if schema != nil {
+		res.Content = map[string]MediaType{"application/json": {schema}}
+	}
+	op.Responses[status] = res
+}
+
+// methods used for routes registered for any method
+var anyMethods = []string{"GET", "PUT", "POST", "DELETE", "PATCH"}
+
+type Generator struct {
+	Info Info
+	// hooks keyed by method and pattern, e.g. "GET /users/:id"
+	hooks map[string]func(*Operation)
+}
+
+func New(title, version string) *Generator {
+	return &Generator{Info{Title: title, Version: version}, map[string]func(*Operation){}}
+}
+
+// Describe registers fn to fill in details of the operation for the route
+// registered with method and pattern, exactly as passed to the router.
+func (g *Generator) Describe(method, pattern string, fn func(*Operation)) {
+	g.hooks[method+" "+pattern] = fn
+}
+
+func (g *Generator) Generate(r *r2.Router) *Document {
+	doc := &Document{OpenAPI: Version, Info: g.Info, Paths: map[string]*PathItem{}}
+	if prefix := r.Prefix(); prefix != "" {
+		doc.Servers = []Server{{prefix}}
+	}
+
+	for _, route := range r.Routes() {
+		path := Path(route.Pattern)
+		item, found := doc.Paths[path]
+		if !found {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		methods := []string{route.Method}
+		if route.Method == "?" {
+			methods = anyMethods
+		}
+		for _, method := range methods {
+			key := strings.ToLower(method)
+			if _, taken := (*item)[key]; taken {
+				continue
+			}
+			(*item)[key] = g.operation(route, method)
+		}
+	}
+	return doc
+}
+
+func (g *Generator) operation(route *r2.Route, method string) *Operation {
+	op := &Operation{OperationID: route.Name, Tags: route.Tags, Responses: map[string]*Response{}}
+	if route.Method == "?" && route.Name != "" {
+		// operationIds must be unique
+		op.OperationID += "_" + strings.ToLower(method)
+	}
+	for _, param := range route.Params {
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:     param.Name,
+			In:       "path",
+			Required: true,
+			Schema:   ParamSchema(param),
+		})
+	}
+	if hook, found := g.hooks[route.Method+" "+route.Pattern]; found {
+		hook(op)
+	}
+	if len(op.Responses) == 0 {
+		op.Responses["default"] = &Response{Description: "default response"}
+	}
+	return op
+}
+
+// Path converts an r2 pattern to an OpenAPI path template, so
+// "/users/:id!int" becomes "/users/{id}". OpenAPI has no wildcards, so
+// "/files/{path...}" becomes "/files/{path}".
+func Path(pattern string) string {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	if parts[len(parts)-1] == "{$}" {
+		// ServeMux's marker of an exact match, which r2 matches anyway
+		parts = parts[:len(parts)-1]
+	}
+	for i, part := range parts {
+		if strings.HasSuffix(part, "...}") {
+			parts[i] = strings.TrimSuffix(part, "...}") + "}"
+			continue
+		}
+		if !strings.HasPrefix(part, ":") {
+			continue
+		}
+		name := part[1:]
+		if j := strings.Index(name, "!"); j != -1 {
+			name = name[:j]
+		}
+		parts[i] = "{" + strings.TrimSpace(name) + "}"
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// ParamSchema derives a schema from the constraint of a path parameter.
+func ParamSchema(param r2.Param) *Schema {
+	switch {
+	case param.Constraint == "int":
+		return &Schema{Type: "integer"}
+	case param.Constraint == "float":
+		return &Schema{Type: "number"}
+	case param.Regexp != nil:
+		return &Schema{Type: "string", Pattern: param.Regexp.String()}
+	}
+	return &Schema{Type: "string"}
+}
+
+func (d *Document) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
@@ -0,0 +1,74 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aver-d/r2"
+)
+
+func f(*r2.Env) {}
+
+func TestPath(t *testing.T) {
+	cases := map[string]string{
+		"/":                      "/",
+		"/users":                 "/users",
+		"/users/:id!int/":        "/users/{id}",
+		"/repos/:owner/:repo":    "/repos/{owner}/{repo}",
+		"/names/:name![dD].+/ok": "/names/{name}/ok",
+		"/items/{id}":            "/items/{id}",
+		"/files/{path...}":       "/files/{path}",
+		"/a/{$}":                 "/a",
+		"/{$}":                   "/",
+	}
+	for in, want := range cases {
+		if got := Path(in); got != want {
+			t.Errorf("%v expected %v, got %v", in, want, got)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	r := r2.NewRouter("/api")
+	r.Get("/users", f)
+	r.Post("/users", f)
+	r.Get("/users/:id!int", f)
+	r.Get("/files/:name![a-z]+", f)
+	r.Route("?", "/any", f)
+
+	g := New("test", "1.0")
+	g.Describe("POST", "/users", func(op *Operation) {
+		op.OperationID = "createUser"
+		op.JSONRequest(&Schema{Type: "object"})
+		op.JSONResponse("201", "created", nil)
+	})
+	doc := g.Generate(r)
+
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "/api" {
+		t.Errorf("expected server /api, got %v", doc.Servers)
+	}
+	post := (*doc.Paths["/users"])["post"]
+	if post == nil || post.OperationID != "createUser" || post.Responses["201"] == nil {
+		t.Fatalf("hook not applied: %+v", post)
+	}
+	id := (*doc.Paths["/users/{id}"])["get"].Parameters[0]
+	if id.Name != "id" || id.In != "path" || !id.Required || id.Schema.Type != "integer" {
+		t.Errorf("unexpected parameter %+v", id)
+	}
+	name := (*doc.Paths["/files/{name}"])["get"].Parameters[0]
+	if name.Schema.Pattern != "^[a-z]+$" {
+		t.Errorf("unexpected pattern %v", name.Schema.Pattern)
+	}
+	if len(*doc.Paths["/any"]) != len(anyMethods) {
+		t.Errorf("expected any route under all methods, got %v", *doc.Paths["/any"])
+	}
+	if _, err := doc.JSON(); err != nil {
+		t.Error(err)
+	}
+	var check map[string]interface{}
+	b, _ := json.Marshal(doc)
+	json.Unmarshal(b, &check)
+	if check["openapi"] != Version {
+		t.Errorf("unexpected document %s", b)
+	}
+}
@@ -0,0 +1,132 @@
+package r2
+
+import "net/url"
+
+// Query gives typed access to query string parameters, like Path does for
+// path parameters. Getters use the first value of a key.
+type Query url.Values
+
+// Query returns the parsed query string, parsing it on first use.
+func (e *Env) Query() Query {
+	if e.query == nil {
+		e.query = Query(e.R.URL.Query())
+	}
+	return e.query
+}
+
+func (q Query) lookup(key string) (string, bool) {
+	vals := q[key]
+	if len(vals) == 0 {
+		return "", false
+	}
+	return vals[0], true
+}
+
+func (q Query) Has(key string) bool {
+	_, found := q.lookup(key)
+	return found
+}
+
+func (q Query) Get(key string) string {
+	val, _ := q.lookup(key)
+	return val
+}
+
+func (q Query) Int(key string) int {
+	val, _ := q.ParseInt(key)
+	return val
+}
+
+func (q Query) Float(key string) float64 {
+	val, _ := q.ParseFloat(key)
+	return val
+}
+
+func (q Query) Bool(key string) bool {
+	val, _ := q.ParseBool(key)
+	return val
+}
+
+// All returns every value of key.
+func (q Query) All(key string) []string {
+	return q[key]
+}
+
+// GetOr returns the value of key, or def if key is missing.
+func (q Query) GetOr(key, def string) string {
+	if val, found := q.lookup(key); found {
+		return val
+	}
+	return def
+}
+
+// IntOr returns the value of key, or def if key is missing or not an integer.
+func (q Query) IntOr(key string, def int) int {
+	if val, err := q.ParseInt(key); err == nil {
+		return val
+	}
+	return def
+}
+
+// FloatOr returns the value of key, or def if key is missing or not a number.
+func (q Query) FloatOr(key string, def float64) float64 {
+	if val, err := q.ParseFloat(key); err == nil {
+		return val
+	}
+	return def
+}
+
+// BoolOr returns the value of key, or def if key is missing or not a boolean.
+func (q Query) BoolOr(key string, def bool) bool {
+	if val, err := q.ParseBool(key); err == nil {
+		return val
+	}
+	return def
+}
+
+func (q Query) ParseInt(key string) (int, error) {
+	str, found := q.lookup(key)
+	return parseInt(key, str, found)
+}
+
+func (q Query) ParseFloat(key string) (float64, error) {
+	str, found := q.lookup(key)
+	return parseFloat(key, str, found)
+}
+
+func (q Query) ParseBool(key string) (bool, error) {
+	str, found := q.lookup(key)
+	return parseBool(key, str, found)
+}
+
+// Ints converts every value of key.
+func (q Query) Ints(key string) ([]int, error) {
+	vals := make([]int, len(q[key]))
+	for i, str := range q[key] {
+		val, err := parseInt(key, str, true)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
+
+// Floats converts every value of key.
+func (q Query) Floats(key string) ([]float64, error) {
+	vals := make([]float64, len(q[key]))
+	for i, str := range q[key] {
+		val, err := parseFloat(key, str, true)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
+
+// Bind sets the fields of the struct pointed to by v, named by their
+// "query" tags or else by field name. Slice fields take every value.
+func (q Query) Bind(v interface{}) error {
+	return bind(q, v, "query", false)
+}
@@ -0,0 +1,59 @@
+package r2
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	env := &Env{R: httptest.NewRequest("GET", "/?n=3&x=1.5&b=true&id=1&id=2&bad=z", nil)}
+	q := env.Query()
+
+	if q.Get("n") != "3" || q.Int("n") != 3 || q.Float("x") != 1.5 || !q.Bool("b") {
+		t.Errorf("unexpected values %v", q)
+	}
+	if !q.Has("bad") || q.Has("missing") || len(q.All("id")) != 2 {
+		t.Errorf("unexpected presence %v", q)
+	}
+	if q.GetOr("missing", "d") != "d" || q.IntOr("bad", 7) != 7 || q.FloatOr("x", 0) != 1.5 || !q.BoolOr("missing", true) {
+		t.Errorf("unexpected defaults %v", q)
+	}
+	if ids, err := q.Ints("id"); err != nil || !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("unexpected ids %v %v", ids, err)
+	}
+
+	var perr *ParamError
+	if _, err := q.ParseInt("bad"); !errors.As(err, &perr) || perr.Value != "z" || perr.Err == nil {
+		t.Errorf("expected invalid value error, got %v", err)
+	}
+	if _, err := q.ParseInt("missing"); !errors.As(err, &perr) || perr.Err != nil {
+		t.Errorf("expected missing error, got %v", err)
+	}
+	if _, err := (Path{{"id", "x"}}).ParseInt("id"); !errors.As(err, &perr) {
+		t.Errorf("expected path error, got %v", err)
+	}
+	if m := (Path{{"a", "1"}, {"b", "2"}}).Map(); len(m) != 2 || m["a"] != "1" || m["b"] != "2" {
+		t.Errorf("unexpected map %v", m)
+	}
+}
+
+func TestQueryBind(t *testing.T) {
+	var args struct {
+		N     int      `query:"n"`
+		IDs   []int    `query:"id"`
+		Limit *float64 `query:"x"`
+		Name  string
+	}
+	q := Query{"n": {"3"}, "id": {"1", "2"}, "x": {"1.5"}, "Name": {"ann"}, "other": {"y"}}
+	if err := q.Bind(&args); err != nil {
+		t.Fatal(err)
+	}
+	if args.N != 3 || len(args.IDs) != 2 || *args.Limit != 1.5 || args.Name != "ann" {
+		t.Errorf("unexpected binding %+v", args)
+	}
+	if err := (Query{"n": {"z"}}).Bind(&args); err == nil {
+		t.Error("expected conversion error")
+	}
+}
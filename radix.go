@@ -0,0 +1,103 @@
+package r2
+
+import "regexp"
+
+// maxScan is the largest number of static children searched in order rather
+// than through a map.
+const maxScan = 8
+
+// radixNode is the compiled, read-only form of the trie used for lookups.
+// Chains of static parts with no routes and no other children are merged
+// into the node above them, so /legacy/issues/search is one node whose
+// rest is ["issues", "search"] rather than three.
+type radixNode struct {
+	// static parts that must follow the part matching this node
+	rest []string
+
+	// static children, keyed by their first part. Small fan-outs use the
+	// parallel keys and statics slices, larger ones the index.
+	keys    []string
+	statics []*radixNode
+	index   map[string]*radixNode
+
+	param     *radixNode
+	wildcard  *radixNode
+	paramName string
+	paramRe   *regexp.Regexp
+
+	handlers map[string]*target
+}
+
+func (r *Router) compile(node *trieNode, merge bool) *radixNode {
+	var rest []string
+	for merge && len(node.handlers) == 0 && len(node.children) == 1 {
+		key := sortedParts(node)[0]
+		if key == any || key == wildcard {
+			break
+		}
+		rest = append(rest, key)
+		node = node.children[key]
+	}
+
+	rn := &radixNode{rest: rest}
+	if node.handlers != nil {
+		rn.handlers = make(map[string]*target, len(node.handlers))
+		for method, route := range node.handlers {
+			rn.handlers[method] = r.chain(route)
+		}
+	}
+	statics := 0
+	for _, part := range sortedParts(node) {
+		child := node.children[part]
+		if part == any {
+			rn.param = r.compile(child, true)
+			rn.param.paramName = child.paramName
+			rn.param.paramRe = child.paramRe
+			continue
+		}
+		if part == wildcard {
+			rn.wildcard = r.compile(child, false)
+			rn.wildcard.paramName = child.paramName
+			continue
+		}
+		statics++
+		c := r.compile(child, true)
+		rn.keys = append(rn.keys, part)
+		rn.statics = append(rn.statics, c)
+	}
+	if statics > maxScan {
+		rn.index = make(map[string]*radixNode, statics)
+		for i, key := range rn.keys {
+			rn.index[key] = rn.statics[i]
+		}
+		rn.keys, rn.statics = nil, nil
+	}
+	return rn
+}
+
+func (rn *radixNode) static(key string) *radixNode {
+	if rn.index != nil {
+		return rn.index[key]
+	}
+	for i, k := range rn.keys {
+		if k == key {
+			return rn.statics[i]
+		}
+	}
+	return nil
+}
+
+// tree returns the compiled trie, compiling it after any change.
+func (r *Router) tree() *radixNode {
+	if t := r.compiled.Load(); t != nil {
+		return t
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.compiled.Load()
+	if t == nil {
+		t = r.compile(r.root.Load(), false)
+		r.compiled.Store(t)
+	}
+	return t
+}
@@ -0,0 +1,206 @@
+// Package ratelimit limits the rate of requests to an r2 Router with token
+// buckets, keyed by client and route.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aver-d/r2"
+)
+
+// MetaKey is the route metadata read for a route's limit: either a Limit,
+// or the name of one of the Limiter's Tiers.
+const MetaKey = "ratelimit"
+
+// Limit allows Burst requests at once, refilled at Rate per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Per returns a limit of n requests in each period.
+func Per(n int, period time.Duration) Limit {
+	return Limit{float64(n) / period.Seconds(), n}
+}
+
+// Result is the state of a bucket after a request takes from it.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// time until the bucket is full again
+	Reset time.Duration
+	// time until a request would be allowed, if this one wasn't
+	RetryAfter time.Duration
+}
+
+// Store holds buckets, so that limits can be shared between processes.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) Result
+}
+
+// KeyFunc returns the client a request is counted against. Requests with
+// an empty key share a bucket.
+type KeyFunc func(*r2.Env) string
+
+// IP keys requests by the address of the connection. Behind a proxy, key
+// by a header the proxy sets instead.
+func IP(env *r2.Env) string {
+	host, _, err := net.SplitHostPort(env.R.RemoteAddr)
+	if err != nil {
+		return env.R.RemoteAddr
+	}
+	return host
+}
+
+// Header keys requests by a header, such as an API key.
+func Header(name string) KeyFunc {
+	return func(env *r2.Env) string {
+		return env.R.Header.Get(name)
+	}
+}
+
+// Principal keys requests by the authenticated client, and requests with
+// none by IP. Authentication middleware must run first.
+func Principal(env *r2.Env) string {
+	if env.Principal != nil {
+		return "principal:" + env.Principal.Name
+	}
+	return IP(env)
+}
+
+type Limiter struct {
+	Key   KeyFunc
+	Store Store
+	// Default applies to routes without a limit of their own, with one
+	// bucket per client across all such routes. A zero Default doesn't
+	// limit them.
+	Default Limit
+	// Routes gives limits by route pattern, each with its own buckets.
+	Routes map[string]Limit
+	// Tiers names limits that routes may refer to in their metadata.
+	Tiers map[string]Limit
+}
+
+// New returns a limiter keyed by IP, with buckets in memory.
+func New(def Limit) *Limiter {
+	return &Limiter{Key: IP, Store: NewMemory(), Default: def}
+}
+
+// limit returns the limit of a route, and the scope of its buckets.
+func (l *Limiter) limit(route *r2.Route) (Limit, string) {
+	if limit, found := l.Routes[route.Pattern]; found {
+		return limit, route.Pattern
+	}
+	switch v := route.Meta[MetaKey].(type) {
+	case Limit:
+		return v, route.Pattern
+	case string:
+		if limit, found := l.Tiers[v]; found {
+			return limit, route.Pattern
+		}
+	}
+	return l.Default, ""
+}
+
+// Middleware answers 429 Too Many Requests to clients over their limit.
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are set
+// on every limited response, and Retry-After on those refused.
+func (l *Limiter) Middleware(next r2.Handler) r2.Handler {
+	return func(env *r2.Env) {
+		limit, scope := l.limit(env.Route)
+		if limit.Burst <= 0 {
+			next(env)
+			return
+		}
+		res := l.Store.Take(scope+"\x00"+l.Key(env), limit, time.Now())
+
+		h := env.W.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", seconds(res.Reset))
+		if !res.Allowed {
+			h.Set("Retry-After", seconds(res.RetryAfter))
+			env.Error(http.StatusTooManyRequests, nil)
+			return
+		}
+		next(env)
+	}
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Memory is a Store for a single process.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(key string, limit Limit, now time.Time) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.swept) > time.Minute {
+		m.sweep(now)
+	}
+
+	b, found := m.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+	b.fill(now)
+
+	res := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = duration((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = duration((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return res
+}
+
+func (b *bucket) fill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// sweep drops full buckets, which are the same as new ones.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		b.fill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
+
+func duration(seconds float64) time.Duration {
+	if math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aver-d/r2"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(Per(2, time.Minute))
+	l.Routes = map[string]Limit{"/search": {Rate: 1, Burst: 1}}
+	l.Tiers = map[string]Limit{"free": {Rate: 1, Burst: 3}}
+
+	r := r2.NewRouter("")
+	r.Use(l.Middleware)
+	ok := func(e *r2.Env) { e.Text(200, "ok") }
+	r.Get("/a", ok)
+	r.Get("/b", ok)
+	r.Get("/search", ok)
+	r.Get("/tiered", ok, r2.Meta(MetaKey, "free"))
+
+	get := func(path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// the default bucket is shared by /a and /b
+	for i, want := range []int{200, 200, 429} {
+		path := []string{"/a", "/b", "/a"}[i]
+		if w := get(path, "10.0.0.1:1"); w.Code != want {
+			t.Errorf("request %v: expected %v, got %v", i, want, w.Code)
+		}
+	}
+	w := get("/b", "10.0.0.1:2")
+	if w.Code != 429 || w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Limit") != "2" ||
+		w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("unexpected response %v %v", w.Code, w.Header())
+	}
+	if w := get("/a", "10.0.0.2:1"); w.Code != 200 {
+		t.Errorf("other client limited: %v", w.Code)
+	}
+
+	// routes with their own limit have their own buckets
+	if w := get("/search", "10.0.0.1:1"); w.Code != 200 {
+		t.Errorf("route limit shares default bucket: %v", w.Code)
+	}
+	if w := get("/search", "10.0.0.1:1"); w.Code != 429 {
+		t.Errorf("route limit not applied: %v", w.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if w := get("/tiered", "10.0.0.1:1"); w.Code != 200 {
+			t.Errorf("tier limit not applied: %v", w.Code)
+		}
+	}
+	if w := get("/tiered", "10.0.0.1:1"); w.Code != 429 {
+		t.Errorf("tier limit not applied: %v", w.Code)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	limit := Limit{Rate: 2, Burst: 2}
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		if res := m.Take("k", limit, now); res.Allowed != want {
+			t.Errorf("take %v: expected %v", i, want)
+		}
+	}
+	res := m.Take("k", limit, now.Add(500*time.Millisecond))
+	if !res.Allowed || res.Remaining != 0 || res.Reset != time.Second {
+		t.Errorf("unexpected refill %+v", res)
+	}
+	m.sweep(now.Add(time.Hour))
+	if len(m.buckets) != 0 {
+		t.Errorf("full buckets kept: %v", len(m.buckets))
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	env := &r2.Env{R: httptest.NewRequest("GET", "/", nil)}
+	if got := Principal(env); got != IP(env) {
+		t.Errorf("expected IP key for anonymous request, got %v", got)
+	}
+	env.Principal = &r2.Principal{Name: "ann"}
+	if got := Principal(env); got != "principal:ann" {
+		t.Errorf("unexpected key %v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package r2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Switch is a stable http.Handler in front of a router that can be replaced
+// as a whole. A new router is built off to the side and swapped in with
+// Swap; requests already dispatched finish on the router that received them.
+type Switch struct {
+	current atomic.Pointer[Router]
+	// Validate, if set, must accept a router before it is swapped in.
+	Validate func(*Router) error
+}
+
+func NewSwitch(r *Router) *Switch {
+	s := &Switch{}
+	s.current.Store(r)
+	return s
+}
+
+func (s *Switch) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.current.Load().ServeHTTP(w, req)
+}
+
+// Router returns the router currently serving requests.
+func (s *Switch) Router() *Router {
+	return s.current.Load()
+}
+
+// Swap validates next and makes it the serving router, returning the
+// differences from the router it replaces. On error nothing is swapped.
+func (s *Switch) Swap(next *Router) (*Diff, error) {
+	if next == nil {
+		return nil, errors.New("r2: cannot swap in a nil router")
+	}
+	if s.Validate != nil {
+		if err := s.Validate(next); err != nil {
+			return nil, err
+		}
+	}
+	prev := s.current.Swap(next)
+	return Compare(prev, next), nil
+}
+
+// Diff lists the routes added, removed and changed between two routers.
+// Routes are the same if they have the same method and pattern, ignoring
+// leading and trailing slashes, and changed if their handler functions,
+// names, tags or metadata differ.
+//
+// Closures made by one function literal share their code, so a handler
+// rebuilt as proxyTo(newURL) looks the same as proxyTo(oldURL). Give such
+// routes metadata that changes with them, e.g. Meta("upstream", newURL).
+type Diff struct {
+	Added   []*Route
+	Removed []*Route
+	// the new versions of changed routes
+	Changed []*Route
+}
+
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d *Diff) String() string {
+	var b strings.Builder
+	for _, group := range []struct {
+		sign   string
+		routes []*Route
+	}{{"+", d.Added}, {"-", d.Removed}, {"~", d.Changed}} {
+		for _, route := range group.routes {
+			fmt.Fprintf(&b, "%v %v %v\n", group.sign, route.Method, route.Pattern)
+		}
+	}
+	return b.String()
+}
+
+// Compare reports how the routes of next differ from those of prev.
+func Compare(prev, next *Router) *Diff {
+	d := &Diff{}
+	old := map[string]*Route{}
+	if prev != nil {
+		for _, route := range prev.Routes() {
+			old[routeKey(prev, route)] = route
+		}
+	}
+	for _, route := range next.Routes() {
+		key := routeKey(next, route)
+		was, found := old[key]
+		delete(old, key)
+		switch {
+		case !found:
+			d.Added = append(d.Added, route)
+		case changed(was, route):
+			d.Changed = append(d.Changed, route)
+		}
+	}
+	if prev != nil {
+		// keep the removed routes in order
+		for _, route := range prev.Routes() {
+			if _, found := old[routeKey(prev, route)]; found {
+				d.Removed = append(d.Removed, route)
+			}
+		}
+	}
+	return d
+}
+
+func routeKey(r *Router, route *Route) string {
+	return route.Method + " " + r.prefix + "/" + strings.Trim(route.Pattern, "/")
+}
+
+func changed(was, route *Route) bool {
+	return funcPointer(was.Handler) != funcPointer(route.Handler) ||
+		was.HandlerName != route.HandlerName || was.Name != route.Name ||
+		!slices.Equal(was.Tags, route.Tags) || !reflect.DeepEqual(was.Meta, route.Meta)
+}
+
+func funcPointer(h Handler) uintptr {
+	return reflect.ValueOf(h).Pointer()
+}
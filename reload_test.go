@@ -0,0 +1,74 @@
+package r2
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSwitch(t *testing.T) {
+	old := NewRouter("")
+	old.Get("/a", f1)
+	old.Get("/b/", f1)
+	old.Post("/c", f1)
+	s := NewSwitch(old)
+
+	next := NewRouter("")
+	next.Get("/a", f1)
+	next.Get("/b", f2)
+	next.Get("/d/:id", f3)
+
+	s.Validate = func(r *Router) error {
+		if len(r.Routes()) == 0 {
+			return errors.New("no routes")
+		}
+		return nil
+	}
+	if _, err := s.Swap(NewRouter("")); err == nil || s.Router() != old {
+		t.Fatal("expected empty router to be rejected")
+	}
+
+	diff, err := s.Swap(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "+ GET /d/:id\n- POST /c\n~ GET /b\n"
+	if diff.String() != expected {
+		t.Errorf("expected diff\n%v got\n%v", expected, diff)
+	}
+
+	handlerId = 0
+	s.ServeHTTP(fakeResp{}, makeRequest("GET", "/d/1"))
+	if handlerId != 3 {
+		t.Errorf("expected new router to serve, got handler %v", handlerId)
+	}
+	if !Compare(next, next).Empty() {
+		t.Error("expected no differences")
+	}
+}
+
+func TestCompareRouteDetails(t *testing.T) {
+	proxyTo := func(url string) Handler {
+		return func(e *Env) { e.Text(200, url) }
+	}
+	build := func(url string, opts ...Option) *Router {
+		r := NewRouter("")
+		r.Get("/proxy", proxyTo(url), append(opts, Meta("upstream", url))...)
+		r.Get("/users/:id", f1, opts...)
+		return r
+	}
+	prev := build("old")
+	cases := []struct {
+		next *Router
+		want string
+	}{
+		{build("old"), ""},
+		{build("new"), "~ GET /proxy\n"},
+		{build("old", Name("n")), "~ GET /proxy\n~ GET /users/:id\n"},
+		{build("old", Tags("t")), "~ GET /proxy\n~ GET /users/:id\n"},
+	}
+	for i, c := range cases {
+		if got := Compare(prev, c.next).String(); got != c.want {
+			t.Errorf("%v: expected %q, got %q", i, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package r2
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RequestID returns middleware setting Env.RequestID from the X-Request-ID
+// header of the request, or with gen if the header is missing or unsafe to
+// log, and setting it on the response. A nil gen uses UUID.
+func RequestID(gen func() string) Middleware {
+	if gen == nil {
+		gen = UUID
+	}
+	return func(next Handler) Handler {
+		return func(env *Env) {
+			id := env.R.Header.Get("X-Request-ID")
+			if !validRequestID(id) {
+				id = gen()
+			}
+			env.RequestID = id
+			env.W.Header().Set("X-Request-ID", id)
+			next(env)
+		}
+	}
+}
+
+// validRequestID accepts IDs of up to 128 printable ASCII characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// UUID returns a random version 4 UUID.
+func UUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a ULID: the time in milliseconds followed by 80 random bits,
+// so that IDs sort by time of creation.
+func ULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint64(b[:8], ms<<16)
+	rand.Read(b[6:])
+
+	var s [26]byte
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// Sequential returns a generator of the IDs prefix1, prefix2 and so on,
+// for tests.
+func Sequential(prefix string) func() string {
+	var n atomic.Uint64
+	return func() string {
+		return prefix + strconv.FormatUint(n.Add(1), 10)
+	}
+}
@@ -0,0 +1,54 @@
+package r2
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	r := NewRouter("")
+	r.Use(RequestID(Sequential("req-")))
+	var panicID string
+	r.PanicHandler = func(e *Env, v interface{}) { panicID = e.RequestID }
+	r.Get("/ok", func(e *Env) { e.Text(200, e.RequestID) })
+	r.Get("/error", func(e *Env) { e.Error(400, nil) })
+	r.Get("/panic", func(e *Env) { panic("oops") })
+
+	for _, c := range []struct{ header, id string }{
+		{"", "req-1"},
+		{"from-client", "from-client"},
+		{"bad\nid", "req-2"},
+	} {
+		req := httptest.NewRequest("GET", "/ok", nil)
+		req.Header.Set("X-Request-ID", c.header)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Body.String() != c.id || w.Header().Get("X-Request-ID") != c.id {
+			t.Errorf("%q expected %v, got %v", c.header, c.id, w.Body.String())
+		}
+	}
+	if w := serve(r, "GET", "/error"); w.Body.String() != `{"error":"Bad Request","request_id":"req-3"}`+"\n" {
+		t.Errorf("unexpected error body %v", w.Body.String())
+	}
+	serve(r, "GET", "/panic")
+	if panicID != "req-4" {
+		t.Errorf("unexpected ID in panic handler %q", panicID)
+	}
+}
+
+func TestRequestIDGenerators(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulid := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	for i := 0; i < 100; i++ {
+		if id := UUID(); !uuid.MatchString(id) {
+			t.Fatalf("invalid UUID %v", id)
+		}
+		if id := ULID(); !ulid.MatchString(id) {
+			t.Fatalf("invalid ULID %v", id)
+		}
+	}
+	if a, b := ULID(), ULID(); a[:10] > b[:10] {
+		t.Errorf("ULID time decreased: %v %v", a, b)
+	}
+}
@@ -0,0 +1,194 @@
+package r2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// response records what has been written so that later features, such as
+// error and panic handlers, know whether the response is committed.
+type response struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *response) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	if informational(status) {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *response) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// ReadFrom lets io.Copy use the underlying writer's ReadFrom, so that
+// files are still sent with sendfile.
+func (w *response) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, src)
+	}
+	w.size += n
+	return n, err
+}
+
+func (w *response) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("r2: response does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (w *response) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// informational reports whether status is a 1xx response that may precede
+// the final one, such as 103 Early Hints.
+func informational(status int) bool {
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// Committed reports whether the status line has been written.
+func (e *Env) Committed() bool {
+	return e.Status() != 0
+}
+
+// Status returns the status written, or 0 if not yet committed. Middleware
+// that wraps Env.W and holds back the response, as Conditional does, reports
+// the status written to it with a Status() int method.
+func (e *Env) Status() int {
+	w := e.W
+	for w != nil && w != http.ResponseWriter(&e.res) {
+		if s, ok := w.(interface{ Status() int }); ok {
+			if status := s.Status(); status != 0 {
+				return status
+			}
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return e.res.status
+}
+
+// Written returns the number of body bytes written.
+func (e *Env) Written() int64 {
+	return e.res.size
+}
+
+func (e *Env) JSON(status int, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.Blob(status, "application/json; charset=utf-8", append(b, '\n'))
+}
+
+func (e *Env) Text(status int, s string) error {
+	return e.Blob(status, "text/plain; charset=utf-8", []byte(s))
+}
+
+func (e *Env) HTML(status int, html string) error {
+	return e.Blob(status, "text/html; charset=utf-8", []byte(html))
+}
+
+// Blob writes b with the given content type.
+func (e *Env) Blob(status int, contentType string, b []byte) error {
+	e.W.Header().Set("Content-Type", contentType)
+	e.W.WriteHeader(status)
+	_, err := e.W.Write(b)
+	return err
+}
+
+// Stream copies src to the response, flushing after each read.
+func (e *Env) Stream(status int, contentType string, src io.Reader) error {
+	e.W.Header().Set("Content-Type", contentType)
+	e.W.WriteHeader(status)
+	flusher, _ := e.W.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := e.W.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *Env) Redirect(status int, url string) {
+	http.Redirect(e.W, e.R, url, status)
+}
+
+func (e *Env) NoContent() {
+	e.W.WriteHeader(http.StatusNoContent)
+}
+
+// Error writes err with the router's ErrorHandler. Nothing is written if the
+// response is already committed.
+func (e *Env) Error(status int, err error) {
+	if e.Committed() {
+		return
+	}
+	if err == nil {
+		err = errors.New(http.StatusText(status))
+	}
+	if e.router != nil && e.router.ErrorHandler != nil {
+		e.router.ErrorHandler(e, status, err)
+		return
+	}
+	body := map[string]interface{}{"error": err.Error()}
+	var invalid ValidationError
+	if errors.As(err, &invalid) {
+		body = map[string]interface{}{"errors": invalid}
+	}
+	if e.RequestID != "" {
+		body["request_id"] = e.RequestID
+	}
+	e.JSON(status, body)
+}
@@ -0,0 +1,124 @@
+package r2
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(r *Router, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestResponseHelpers(t *testing.T) {
+	r := NewRouter("")
+	r.Get("/json", func(e *Env) { e.JSON(201, map[string]int{"a": 1}) })
+	r.Get("/text", func(e *Env) { e.Text(200, "hi") })
+	r.Get("/html", func(e *Env) { e.HTML(200, "<p>hi</p>") })
+	r.Get("/none", func(e *Env) { e.NoContent() })
+	r.Get("/redirect", func(e *Env) { e.Redirect(http.StatusFound, "/text") })
+	r.Get("/stream", func(e *Env) { e.Stream(200, "text/csv", strings.NewReader("a,b\n")) })
+	r.Get("/error", func(e *Env) { e.Error(http.StatusTeapot, errors.New("short and stout")) })
+
+	cases := []struct {
+		path, contentType, body string
+		status                  int
+	}{
+		{"/json", "application/json; charset=utf-8", `{"a":1}` + "\n", 201},
+		{"/text", "text/plain; charset=utf-8", "hi", 200},
+		{"/html", "text/html; charset=utf-8", "<p>hi</p>", 200},
+		{"/none", "", "", 204},
+		{"/stream", "text/csv", "a,b\n", 200},
+		{"/error", "application/json; charset=utf-8", `{"error":"short and stout"}` + "\n", 418},
+	}
+	for _, c := range cases {
+		w := serve(r, "GET", c.path)
+		if w.Code != c.status || w.Header().Get("Content-Type") != c.contentType || w.Body.String() != c.body {
+			t.Errorf("%v: unexpected response %v %q %q", c.path, w.Code, w.Header().Get("Content-Type"), w.Body)
+		}
+	}
+	if w := serve(r, "GET", "/redirect"); w.Code != http.StatusFound || w.Header().Get("Location") != "/text" {
+		t.Errorf("unexpected redirect %v %v", w.Code, w.Header())
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	var committed bool
+	r := NewRouter("")
+	r.PanicHandler = func(e *Env, v interface{}) {
+		committed = e.Committed()
+		e.Error(http.StatusInternalServerError, nil)
+	}
+	r.ErrorHandler = func(e *Env, status int, err error) {
+		e.Text(status, err.Error())
+	}
+	r.Get("/before", func(e *Env) { panic("boom") })
+	r.Get("/after", func(e *Env) {
+		e.Text(200, "partial")
+		panic("boom")
+	})
+
+	w := serve(r, "GET", "/before")
+	if committed || w.Code != 500 || w.Body.String() != "Internal Server Error" {
+		t.Errorf("unexpected response %v %q", w.Code, w.Body)
+	}
+	w = serve(r, "GET", "/after")
+	if !committed || w.Code != 200 || w.Body.String() != "partial" {
+		t.Errorf("unexpected response %v %q", w.Code, w.Body)
+	}
+}
+
+// statusRecorder records every status written, including informational ones.
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.codes = append(w.codes, status)
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func TestInformational(t *testing.T) {
+	r := NewRouter("")
+	r.Get("/", func(e *Env) {
+		e.W.WriteHeader(http.StatusEarlyHints)
+		e.Text(200, "hi")
+	})
+	w := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(w.codes) != 2 || w.codes[0] != 103 || w.codes[1] != 200 || w.Body.String() != "hi" {
+		t.Errorf("unexpected statuses %v %q", w.codes, w.Body)
+	}
+}
+
+// readerFromRecorder records whether ReadFrom was used.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	used bool
+}
+
+func (w *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	w.used = true
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestReadFrom(t *testing.T) {
+	var written int64
+	r := NewRouter("")
+	r.Get("/", func(e *Env) {
+		// a reader without WriteTo, so that io.Copy calls ReadFrom
+		io.Copy(e.W, io.LimitReader(strings.NewReader("file contents"), 100))
+		written = e.Written()
+	})
+	w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !w.used || w.Code != 200 || w.Body.String() != "file contents" || written != 13 {
+		t.Errorf("unexpected response %v %v %q %v", w.used, w.Code, w.Body, written)
+	}
+}
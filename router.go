@@ -1,23 +1,92 @@
 package r2
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"reflect"
 	"regexp"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var puts = fmt.Println
 
+// Env is the environment of a request. Envs are pooled and reused, so an
+// Env, and its Path, must not be kept after the handler returns.
 type Env struct {
 	R    *http.Request
 	W    http.ResponseWriter
 	Path Path
+	// values checked against the route's Spec, if it has one
+	Input *Input
+	// the matched route, for example to key metrics by pattern rather
+	// than by path. Shared by all requests, so it must not be modified.
+	Route *Route
+	// set by the RequestID middleware, to correlate logs of the request
+	RequestID string
+	// the authenticated client, set by authentication middleware
+	Principal *Principal
+
+	router *Router
+	res    response
+	query  Query
+	values map[interface{}]interface{}
+}
+
+// Principal is a client identified by authentication middleware.
+type Principal struct {
+	Name string
+	// the authentication scheme used, such as "Basic" or "Bearer"
+	Scheme string
+	Scopes []string
+	// claims of a token, if any
+	Claims map[string]interface{}
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && slices.Contains(p.Scopes, scope)
+}
+
+var envPool = sync.Pool{
+	New: func() interface{} {
+		return &Env{Path: make(Path, 0, 8)}
+	},
+}
+
+// reset clears env for reuse, keeping the storage of its Path and values.
+func (env *Env) reset() {
+	values := env.values
+	clear(values)
+	*env = Env{Path: env.Path[:0], values: values}
+}
+
+// Set stores a value for the rest of the request, for middleware to pass
+// on to handlers. Keys follow the rules of context keys.
+func (env *Env) Set(key, value interface{}) {
+	if env.values == nil {
+		env.values = map[interface{}]interface{}{}
+	}
+	env.values[key] = value
+}
+
+// Value returns the value stored for key, or nil.
+func (env *Env) Value(key interface{}) interface{} {
+	return env.values[key]
+}
+
+// Meta returns the value of key in the matched route's metadata, or nil.
+func (e *Env) Meta(key string) interface{} {
+	if e.Route == nil {
+		return nil
+	}
+	return e.Route.Meta[key]
 }
 
 type Handler func(*Env)
@@ -25,22 +94,126 @@ type Handler func(*Env)
 const (
 	any      = "?"
 	regexSep = "!"
+	// key of a child matching the rest of the path, which no static part
+	// can have as it contains the separator
+	wildcard = "/"
+	// ServeMux's marker for the end of a path
+	exact = "{$}"
 )
 
 type trieNode struct {
 	// each node may have zero or more children, but at most ONE child can be a parameter.
 	children map[string]*trieNode
-	// http method to handler
-	handlers map[string]Handler
+	// http method to route
+	handlers map[string]*Route
 	// the name of the parameter for this node (if any)
 	paramName string
 	paramRe   *regexp.Regexp
 }
 
+// Route is a registered method and path pattern. Method is the key the
+// route is stored under, so "?" for a route matching any method.
+type Route struct {
+	Method  string
+	Pattern string
+	Params  []Param
+	Handler Handler
+	// name of the handler function, found when the route is registered
+	HandlerName string
+	// set with the Name, Tags and Meta options
+	Name string
+	Tags []string
+	Meta map[string]interface{}
+
+	spec       *Spec
+	middleware []Middleware
+	cors       *CORS
+	// set the path values of the request, for patterns in ServeMux syntax
+	pathValues bool
+}
+
+// Option configures a route when it is registered.
+type Option func(*Route)
+
+// Name names a route, for finding it with Router.Named.
+func Name(name string) Option {
+	return func(route *Route) {
+		route.Name = name
+	}
+}
+
+func Tags(tags ...string) Option {
+	return func(route *Route) {
+		route.Tags = append(route.Tags, tags...)
+	}
+}
+
+// Meta attaches a value to a route, such as an auth scope or owning team,
+// for handlers to read from Env.Route.
+func Meta(key string, value interface{}) Option {
+	return func(route *Route) {
+		if route.Meta == nil {
+			route.Meta = map[string]interface{}{}
+		}
+		route.Meta[key] = value
+	}
+}
+
+// Param describes a path parameter of a route. Constraint is the text after
+// the regex separator, e.g. "int" for ":id!int", and empty if unconstrained.
+type Param struct {
+	Name       string
+	Constraint string
+	Regexp     *regexp.Regexp
+	// set for {name...}, which matches the rest of the path
+	Wildcard bool
+}
+
 type Router struct {
-	root    *trieNode
+	// the trie is never modified once stored, so lookups need no lock
+	root atomic.Pointer[trieNode]
+	// compiled from root on demand, and cleared whenever root changes
+	compiled atomic.Pointer[radixNode]
+	// serializes changes to the trie and the regex cache
+	mu      sync.Mutex
 	prefix  string
 	regexes map[string]*regexp.Regexp
+
+	// ErrorHandler writes the response for Env.Error. If nil, the error is
+	// written as JSON.
+	ErrorHandler func(env *Env, status int, err error)
+	// PanicHandler, if set, recovers panics in handlers. Check Env.Committed
+	// before writing an error response.
+	PanicHandler func(env *Env, v interface{})
+	// MaxBodySize limits the bytes read by Env.Decode. Zero means no limit.
+	MaxBodySize int64
+	// StrictDecoding makes Env.Decode reject fields unknown to the target.
+	StrictDecoding bool
+	// CORS, if set, allows cross-origin requests to routes without their
+	// own configuration.
+	CORS *CORS
+
+	// Hooks observe requests as they are dispatched, e.g. for tracing.
+	Hooks Hooks
+
+	// replaced, never modified, when a codec is registered
+	codecs     atomic.Pointer[codecs]
+	middleware []Middleware
+}
+
+// Hooks are called at each stage of dispatching a request; any may be nil.
+// Env.R and Env.W are set for all of them, and Env.Path and Env.Route
+// from Matched on.
+type Hooks struct {
+	Request          func(*Env)
+	NotFound         func(*Env)
+	MethodNotAllowed func(*Env)
+	// after the router answers a CORS preflight request
+	Preflight func(*Env)
+	Matched   func(*Env)
+	// around the route's middleware and handler
+	HandlerStart func(*Env)
+	HandlerEnd   func(*Env)
 }
 
 func newNode() *trieNode {
@@ -48,103 +221,243 @@ func newNode() *trieNode {
 }
 
 func NewRouter(prefix string) *Router {
-	return &Router{newNode(), prefix, map[string]*regexp.Regexp{}}
+	r := &Router{
+		prefix:  prefix,
+		regexes: map[string]*regexp.Regexp{},
+	}
+	r.root.Store(newNode())
+	r.codecs.Store(newCodecs())
+	return r
 }
 
-func (r *Router) Route(method, path string, handler Handler) {
-	r.route(path, handler, method)
+func (r *Router) Route(method, path string, handler Handler, opts ...Option) {
+	r.route(path, handler, method, opts)
 }
-func (r *Router) Get(path string, handler Handler) {
-	r.route(path, handler, "GET")
+
+// Handle registers a pattern in ServeMux syntax, "[METHOD ]/path", where
+// a pattern without a method matches any method. Captured values are
+// available from both Env.Path and the request's PathValue. As in ServeMux,
+// a path ending in a slash matches everything below it, captured as the
+// path value "path", unless it ends in {$}.
+func (r *Router) Handle(pattern string, handler Handler, opts ...Option) {
+	method, path := splitMuxPattern(pattern)
+	r.route(path, handler, method, opts)
 }
-func (r *Router) Post(path string, handler Handler) {
-	r.route(path, handler, "POST")
+
+// splitMuxPattern splits a ServeMux pattern into its method and an r2 path.
+func splitMuxPattern(pattern string) (method, path string) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = any, pattern
+	}
+	path = strings.TrimSpace(path)
+	if strings.HasSuffix(path, "/") {
+		path += "{path...}"
+	}
+	return method, path
 }
-func (r *Router) Put(path string, handler Handler) {
-	r.route(path, handler, "PUT")
+
+func (r *Router) Get(path string, handler Handler, opts ...Option) {
+	r.route(path, handler, "GET", opts)
+}
+func (r *Router) Post(path string, handler Handler, opts ...Option) {
+	r.route(path, handler, "POST", opts)
+}
+func (r *Router) Put(path string, handler Handler, opts ...Option) {
+	r.route(path, handler, "PUT", opts)
 }
-func (r *Router) Delete(path string, handler Handler) {
-	r.route(path, handler, "DELETE")
+func (r *Router) Delete(path string, handler Handler, opts ...Option) {
+	r.route(path, handler, "DELETE", opts)
 }
-func (r *Router) Patch(path string, handler Handler) {
-	r.route(path, handler, "PATCH")
+func (r *Router) Patch(path string, handler Handler, opts ...Option) {
+	r.route(path, handler, "PATCH", opts)
 }
 
-func (r Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// start := time.Now()
-	handlerMap, pathVars := r.get(req.URL.Path)
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	env := envPool.Get().(*Env)
+	defer release(env)
+
+	env.R, env.router = req, r
+	env.res.ResponseWriter = w
+	env.W = &env.res
+	hooks := &r.Hooks
+	if hooks.Request != nil {
+		hooks.Request(env)
+	}
 
-	if handlerMap == nil {
-		http.NotFound(w, req)
+	routes, pathVars := r.get(req.URL.Path, env.Path)
+	env.Path = pathVars
+
+	if routes == nil {
+		if hooks.NotFound != nil {
+			hooks.NotFound(env)
+		}
+		http.NotFound(env.W, req)
+		return
+	}
+
+	if r.preflight(env, routes) {
+		if hooks.Preflight != nil {
+			hooks.Preflight(env)
+		}
 		return
 	}
 
-	handler, found := handlerMap[req.Method]
+	t, found := routes[req.Method]
+	if !found && req.Method == http.MethodHead {
+		// answered by the GET route; the server discards the body
+		t, found = routes[http.MethodGet]
+	}
 	if !found {
-		handler, found = handlerMap[any]
+		t, found = routes[any]
 		if !found {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			if hooks.MethodNotAllowed != nil {
+				hooks.MethodNotAllowed(env)
+			}
+			env.W.Header().Set("Allow", allowed(routes))
+			http.Error(env.W, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 	}
-	env := &Env{R: req, W: w, Path: pathVars}
-	handler(env)
-	// puts(time.Now().Sub(start), "\n")
+	route := t.route
+	if route.pathValues {
+		for _, v := range pathVars {
+			req.SetPathValue(v.Name, v.Value)
+		}
+	}
+	env.Route = route
+	r.decorate(env, route)
+	if hooks.Matched != nil {
+		hooks.Matched(env)
+	}
+	if hooks.HandlerEnd != nil {
+		// deferred before recovering, so it sees the response of PanicHandler
+		defer hooks.HandlerEnd(env)
+	}
+	if r.PanicHandler != nil {
+		defer func() {
+			if v := recover(); v != nil {
+				r.PanicHandler(env, v)
+			}
+		}()
+	}
+	if hooks.HandlerStart != nil {
+		hooks.HandlerStart(env)
+	}
+	t.handler(env)
 }
 
-func (r *Router) route(urlPath string, handler Handler, method string) {
+func release(env *Env) {
+	env.reset()
+	envPool.Put(env)
+}
 
-	failIfEmpty(urlPath, handler)
+func (r *Router) route(urlPath string, handler Handler, method string, opts []Option) {
+	if err := r.insert(method, urlPath, handler, opts, false); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	node := r.root
+// insert adds a route to a copy of the trie, sharing the nodes off the
+// route's path, and swaps the copy in so lookups never see a partial update.
+func (r *Router) insert(method, urlPath string, handler Handler, opts []Option, replace bool) error {
 
-	if urlPath == "/" {
-		r.add(urlPath, node, handler, method)
-		return
+	if err := checkEmpty(urlPath, handler); err != nil {
+		return err
+	}
+	route := &Route{Method: method, Pattern: urlPath, Handler: handler, HandlerName: funcName(handler)}
+	for _, opt := range opts {
+		opt(route)
 	}
 
-	for _, part := range split(urlPath) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		isParam := strings.HasPrefix(part, ":")
-		name, regex := r.separate(part)
+	root := r.root.Load().clone()
+	node := root
 
-		if isParam && !validParam(name, node) {
-			log.Fatal(fmt.Sprintf("parameter conflict routing %v with handler %v", urlPath, funcName(handler)))
-		}
+	if urlPath != "/" {
+		parts := split(urlPath)
+		for i, part := range parts {
 
-		key := name
-		if isParam {
-			key = any
-		}
-		// if there's already a child node for this part of the path,
-		// then use it and descend
-		child, found := node.children[key]
-		if found {
+			if part == exact && i == len(parts)-1 {
+				// ServeMux's {$}, which r2 matches anyway
+				break
+			}
+			key, name, regex, err := r.separate(part)
+			if err != nil {
+				return err
+			}
+			isParam := key == any || key == wildcard
+
+			if isParam {
+				route.Params = append(route.Params, Param{name, constraint(part), regex, key == wildcard})
+			}
+			if strings.HasPrefix(part, "{") {
+				route.pathValues = true
+			}
+			if key == wildcard && i != len(parts)-1 {
+				return fmt.Errorf("wildcard %v must end path %v", part, urlPath)
+			}
+
+			if isParam && !validParam(key, name, node) {
+				return fmt.Errorf("parameter conflict routing %v with handler %v", urlPath, funcName(handler))
+			}
+
+			// if there's already a child node for this part of the path,
+			// then copy it and descend
+			child, found := node.children[key]
+			if found {
+				child = child.clone()
+			} else {
+				child = newNode()
+				if isParam {
+					child.paramName = name
+					child.paramRe = regex
+				}
+			}
+			node.children[key] = child
 			node = child
-			continue
 		}
+	}
+
+	if err := add(urlPath, node, route, replace); err != nil {
+		return err
+	}
+	r.store(root)
+	return nil
+}
 
-		child = newNode()
-		node.children[key] = child
+// store swaps in a new trie. The caller holds r.mu.
+func (r *Router) store(root *trieNode) {
+	r.root.Store(root)
+	r.compiled.Store(nil)
+}
 
-		if isParam {
-			child.paramName = name
-			child.paramRe = regex
+// clone copies a node and its maps, but not its children.
+func (node *trieNode) clone() *trieNode {
+	c := *node
+	c.children = make(map[string]*trieNode, len(node.children))
+	for key, child := range node.children {
+		c.children[key] = child
+	}
+	if node.handlers != nil {
+		c.handlers = make(map[string]*Route, len(node.handlers))
+		for method, route := range node.handlers {
+			c.handlers[method] = route
 		}
-		node = child
 	}
-
-	r.add(urlPath, node, handler, method)
+	return &c
 }
 
-func validParam(name string, node *trieNode) bool {
+func validParam(key, name string, node *trieNode) bool {
 
 	// if node is a leaf, there's no conflict
 	if len(node.children) == 0 {
 		return true
 	}
-	// check to see if a parameter has already been stored
-	prevNode, prevParam := node.children[any]
+	// check to see if a parameter (or wildcard) has already been stored
+	prevNode, prevParam := node.children[key]
 	if !prevParam {
 		// no previous param has been stored (only static parts), so no conflict
 		return true
@@ -155,44 +468,61 @@ func validParam(name string, node *trieNode) bool {
 	return name == prevNode.paramName
 }
 
-func (r *Router) add(urlPath string, node *trieNode, handler Handler, method string) {
+func add(urlPath string, node *trieNode, route *Route, replace bool) error {
 
 	if node.handlers == nil {
-		node.handlers = make(map[string]Handler)
+		node.handlers = make(map[string]*Route)
 	}
 
 	// check if handler for method already stored
-	_, found := node.handlers[method]
-	if found {
-		log.Fatal(fmt.Sprintf("existing method %v found for path %v", method, urlPath))
+	_, found := node.handlers[route.Method]
+	if found && !replace {
+		return fmt.Errorf("existing method %v found for path %v", route.Method, urlPath)
+	}
+	if !found && replace {
+		return fmt.Errorf("no method %v found for path %v", route.Method, urlPath)
 	}
-	node.handlers[method] = handler
+	node.handlers[route.Method] = route
+	return nil
 }
 
-func (r *Router) get(path string) (map[string]Handler, Path) {
+// get finds the routes for path, appending any path parameters to vars.
+func (r *Router) get(path string, vars Path) (map[string]*target, Path) {
 
 	if !strings.HasPrefix(path, r.prefix) {
-		return nil, nil
+		return nil, vars
 	}
 
 	path = path[len(r.prefix):]
 	l := len(path)
 
+	root := r.tree()
+
+	node := root
 	if l == 0 || (l == 1 && path[0] == '/') {
-		return r.root.handlers, nil
+		path, l = "", 0
 	}
-	node := r.root
-	var found bool
-	var next *trieNode
+	var next *radixNode
 	var key string
-	var vars Path
+	// static parts of a merged chain still to be matched
+	var rest []string
+	// the deepest wildcard passed, where the path it would take starts, and
+	// the vars before it; a lookup that dead-ends falls back to it
+	var fallback *radixNode
+	var fallbackAt, fallbackVars int
+	miss := func() (map[string]*target, Path) {
+		if fallback == nil {
+			return nil, vars
+		}
+		return fallback.handlers, append(vars[:fallbackVars], PathVar{fallback.paramName, path[fallbackAt:]})
+	}
 
 	// ignore leading and trailing slashes -- could make this an option
-	if path[0] == '/' {
+	if l > 0 && path[0] == '/' {
 		path = path[1:]
 		l -= 1
 	}
-	if path[l-1] == '/' {
+	if l > 0 && path[l-1] == '/' {
 		path = path[:l]
 	}
 
@@ -206,75 +536,130 @@ func (r *Router) get(path string) (map[string]Handler, Path) {
 				end += 1
 			}
 			key = path[start:end]
+			start = pos + 1
+
+			if len(rest) > 0 {
+				if key != rest[0] {
+					return miss()
+				}
+				rest = rest[1:]
+				continue
+			}
+			if node.wildcard != nil {
+				fallback, fallbackAt, fallbackVars = node.wildcard, end-len(key), len(vars)
+			}
 
 			// check first for a static part
-			next, found = node.children[key]
-			if !found {
+			next = node.static(key)
+			if next == nil {
 				// not found, so check now if a param is available
-				next, found = node.children[any]
-				if !found {
-					return nil, nil
+				next = node.param
+				// if a regex, check it matches
+				if next != nil && next.paramRe != nil && !next.paramRe.MatchString(key) {
+					next = nil
 				}
-				// finally, if a regex, check it matches
-				if next.paramRe != nil && !next.paramRe.MatchString(key) {
-					return nil, nil
+				if next == nil {
+					// finally, a wildcard takes the rest of the path
+					if node.wildcard == nil {
+						return miss()
+					}
+					node = node.wildcard
+					return node.handlers, append(vars, PathVar{node.paramName, path[end-len(key):]})
 				}
 
-				if vars == nil {
-					vars = make(Path)
-				}
-				vars[next.paramName] = key
+				vars = append(vars, PathVar{next.paramName, key})
 			}
-			start = pos + 1
 			node = next
+			rest = node.rest
 		}
 	}
+	if len(rest) > 0 {
+		return miss()
+	}
+	if node.handlers == nil && node.wildcard != nil {
+		// a wildcard also matches nothing
+		node = node.wildcard
+		return node.handlers, append(vars, PathVar{node.paramName, ""})
+	}
+	if node.handlers == nil {
+		return miss()
+	}
 	return node.handlers, vars
 }
 
-func (r *Router) separate(s string) (string, *regexp.Regexp) {
-	// todo: pass in full path and handler function name to display with error message
-	// or return error and show elsewhere
+// separate returns the trie key of a path part, with the name and regex
+// of a parameter. Parameters are :name or :name!regex, or {name} and
+// {name...} as in ServeMux patterns.
+func (r *Router) separate(s string) (key, name string, regex *regexp.Regexp, err error) {
+
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		key = any
+		name = s[1 : len(s)-1]
+		if strings.HasSuffix(name, "...") {
+			key = wildcard
+			name = strings.TrimSuffix(name, "...")
+		}
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			return "", "", nil, errors.New("parameter must have name: " + s)
+		}
+		if s == exact {
+			return "", "", nil, errors.New(exact + " must end a path")
+		}
+		return key, name, nil, nil
+	}
 
 	if !strings.HasPrefix(s, ":") {
-		return s, nil
+		return s, s, nil, nil
 	}
 
 	i := strings.Index(s, regexSep)
 	useRegex := i != -1
 
 	// remove initial colon
-	name := s[1:]
+	name = s[1:]
 	if useRegex {
 		// if a regex provided, take only up to the regex separator "!"
 		name = s[1:i]
 	}
 	name = strings.TrimSpace(name)
 	if len(name) == 0 {
-		log.Fatal("parameter must have name: " + s)
+		return "", "", nil, errors.New("parameter must have name: " + s)
 	}
 	if !useRegex {
-		return name, nil
+		return any, name, nil, nil
 	}
 	// add one to skip separator
 	pattern := s[i+1:]
 	regex, found := r.regexes[pattern]
 	if found {
-		return name, regex
+		return any, name, regex, nil
+	}
+	regex, err = compileRe(pattern)
+	if err != nil {
+		return "", "", nil, err
 	}
-	regex = compileRe(pattern)
 	r.regexes[pattern] = regex
-	return name, regex
+	return any, name, regex, nil
+}
+
+// constraint returns the text following the regex separator in a path part.
+func constraint(part string) string {
+	i := strings.Index(part, regexSep)
+	if i == -1 || !strings.HasPrefix(part, ":") {
+		return ""
+	}
+	return part[i+1:]
 }
 
 func split(path string) []string {
 	return strings.Split(strings.Trim(path, "/"), "/")
 }
 
-func compileRe(pattern string) *regexp.Regexp {
+func compileRe(pattern string) (*regexp.Regexp, error) {
 	switch pattern {
 	case "":
-		log.Fatal("no pattern provided")
+		return nil, errors.New("no pattern provided")
 	case "int":
 		pattern = `^-?\d+$`
 	case "float":
@@ -287,20 +672,17 @@ func compileRe(pattern string) *regexp.Regexp {
 			pattern += "$"
 		}
 	}
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	return re
+	return regexp.Compile(pattern)
 }
 
-func failIfEmpty(path string, handler Handler) {
+func checkEmpty(path string, handler Handler) error {
 	if handler == nil {
-		log.Fatal("nil handler for path: " + path)
+		return errors.New("nil handler for path: " + path)
 	}
 	if path == "" {
-		log.Fatal("urlPath empty string for handler: " + funcName(handler))
+		return errors.New("urlPath empty string for handler: " + funcName(handler))
 	}
+	return nil
 }
 
 func funcName(i interface{}) string {
@@ -309,36 +691,164 @@ func funcName(i interface{}) string {
 	return name[dot+1:]
 }
 
-type Path map[string]string
+// Path holds the values of path parameters in the order they appear.
+//
+// Path was a map[string]string before lookups became allocation free.
+// Code indexing it, as in env.Path["id"], should use env.Path.Get("id"),
+// and code needing a map can use Map.
+type Path []PathVar
 
-func (p Path) Get(key string) string {
-	if p == nil {
-		return ""
+type PathVar struct {
+	Name  string
+	Value string
+}
+
+func (p Path) lookup(key string) (string, bool) {
+	for _, v := range p {
+		if v.Name == key {
+			return v.Value, true
+		}
 	}
-	val, _ := p[key]
+	return "", false
+}
+
+func (p Path) Get(key string) string {
+	val, _ := p.lookup(key)
 	return val
 }
 
-func (p Path) Int(key string) int {
-	if p == nil {
-		return 0
+// Map copies the values into a map, for code written when Path was one.
+// It allocates, unlike the other accessors.
+func (p Path) Map() map[string]string {
+	m := make(map[string]string, len(p))
+	for _, v := range p {
+		m[v.Name] = v.Value
 	}
-	str, _ := p[key]
-	val, _ := strconv.Atoi(str)
+	return m
+}
+
+func (p Path) Int(key string) int {
+	val, _ := p.ParseInt(key)
 	return val
 }
 
 func (p Path) Float(key string) float64 {
-	if p == nil {
-		return 0
-	}
-	str, _ := p[key]
-	val, _ := strconv.ParseFloat(str, 64)
+	val, _ := p.ParseFloat(key)
 	return val
 }
 
+func (p Path) ParseInt(key string) (int, error) {
+	str, found := p.lookup(key)
+	return parseInt(key, str, found)
+}
+
+func (p Path) ParseFloat(key string) (float64, error) {
+	str, found := p.lookup(key)
+	return parseFloat(key, str, found)
+}
+
+// ParamError reports a missing or unconvertible path or query parameter.
+type ParamError struct {
+	Key   string
+	Value string
+	// nil if the parameter is missing
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("r2: missing parameter %q", e.Key)
+	}
+	return fmt.Sprintf("r2: parameter %q: invalid value %q", e.Key, e.Value)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// conversions shared by Path and Query
+
+func parseInt(key, str string, found bool) (int, error) {
+	if !found {
+		return 0, &ParamError{Key: key}
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, &ParamError{key, str, err}
+	}
+	return val, nil
+}
+
+func parseFloat(key, str string, found bool) (float64, error) {
+	if !found {
+		return 0, &ParamError{Key: key}
+	}
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, &ParamError{key, str, err}
+	}
+	return val, nil
+}
+
+func parseBool(key, str string, found bool) (bool, error) {
+	if !found {
+		return false, &ParamError{Key: key}
+	}
+	val, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, &ParamError{key, str, err}
+	}
+	return val, nil
+}
+
+func (r *Router) Prefix() string {
+	return r.prefix
+}
+
+// Routes returns every registered route, ordered by path and then method.
+func (r *Router) Routes() []*Route {
+	var routes []*Route
+	walk(r.root.Load(), func(node *trieNode) {
+		for _, method := range sortedMethods(node) {
+			routes = append(routes, node.handlers[method])
+		}
+	})
+	return routes
+}
+
+// Named returns the first route with the given name, or nil.
+func (r *Router) Named(name string) *Route {
+	for _, route := range r.Routes() {
+		if route.Name == name {
+			return route
+		}
+	}
+	return nil
+}
+
+// Tagged returns the routes with the given tag.
+func (r *Router) Tagged(tag string) []*Route {
+	var routes []*Route
+	for _, route := range r.Routes() {
+		for _, t := range route.Tags {
+			if t == tag {
+				routes = append(routes, route)
+				break
+			}
+		}
+	}
+	return routes
+}
+
+func walk(node *trieNode, fn func(*trieNode)) {
+	fn(node)
+	for _, part := range sortedParts(node) {
+		walk(node.children[part], fn)
+	}
+}
+
 func (r *Router) Print() {
-	printTree("", strings.TrimLeft(r.prefix, "/"), r.root, true)
+	printTree("", strings.TrimLeft(r.prefix, "/"), r.root.Load(), true)
 }
 
 func printTree(prefix, name string, node *trieNode, last bool) {
@@ -350,10 +860,16 @@ func printTree(prefix, name string, node *trieNode, last bool) {
 	} else {
 		s += "├"
 	}
-	s += "───" + strings.Replace(name, "?", ":", 1) + node.paramName
+	switch name {
+	case any:
+		name = ":" + node.paramName
+	case wildcard:
+		name = "{" + node.paramName + "...}"
+	}
+	s += "───" + name
 
-	for method, h := range node.handlers {
-		s += " " + fmt.Sprintf("%v %v", method, funcName(h))
+	for method, route := range node.handlers {
+		s += " " + fmt.Sprintf("%v %v", method, route.HandlerName)
 	}
 	puts(s)
 
@@ -382,3 +898,12 @@ func sortedParts(node *trieNode) []string {
 	sort.Strings(parts)
 	return parts
 }
+
+func sortedMethods(node *trieNode) []string {
+	methods := make([]string, 0, len(node.handlers))
+	for method := range node.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
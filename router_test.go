@@ -3,6 +3,8 @@ package r2
 import (
 	"net/http"
 	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -333,9 +335,9 @@ var simpleApiQuestions = []*question{
 	{"POST", "/", 0, Path{}},
 	{"GET", "/users", 1, Path{}},
 	{"GET", "/users/", 1, Path{}},
-	{"GET", "/users/dave", 1, Path{"user": "dave"}},
-	{"GET", "/users/bill", 1, Path{"user": "bill"}},
-	{"GET", "/users/bill/starred", 1, Path{"user": "bill"}},
+	{"GET", "/users/dave", 1, Path{{"user", "dave"}}},
+	{"GET", "/users/bill", 1, Path{{"user", "bill"}}},
+	{"GET", "/users/bill/starred", 1, Path{{"user", "bill"}}},
 	{"GET", "/users/topusers", 1, Path{}},
 	{"DELETE", "/users/topusers/hey", 0, Path{}},
 
@@ -355,11 +357,11 @@ func apiTest(endpoints []*endpoint, questions []*question, t *testing.T) {
 	for _, ep := range endpoints {
 		r.Route(ep.method, ep.path, ep.handler)
 	}
-	printTree("", "/", r.root, true)
+	printTree("", "/", r.root.Load(), true)
 
 	for _, ques := range questions {
 		// reset pathVars and value of handlerId
-		pathVars = make(Path)
+		pathVars = nil
 		handlerId = 0
 
 		req := makeRequest(ques.method, ques.path)
@@ -382,3 +384,243 @@ func TestSimple(t *testing.T) {
 func TestGithub(t *testing.T) {
 	apiTest(githubAPI, []*question{}, t)
 }
+
+func TestLookupAllocs(t *testing.T) {
+	r := newRouter(githubAPI)
+	for _, path := range []string{"/user/repos", "/repos/julienschmidt/httprouter/stargazers"} {
+		req := makeRequest("GET", path)
+		allocs := testing.AllocsPerRun(100, func() { r.ServeHTTP(fakeResp{}, req) })
+		if allocs != 0 {
+			t.Errorf("%v: expected no allocations, got %v", path, allocs)
+		}
+	}
+}
+
+// trieGet is the original lookup over the uncompiled trie, kept as a
+// reference for the compiled radix tree.
+func trieGet(root *trieNode, path string) (map[string]*Route, Path) {
+	l := len(path)
+
+	if l == 0 || (l == 1 && path[0] == '/') {
+		return root.handlers, nil
+	}
+	node := root
+	var found bool
+	var next *trieNode
+	var key string
+	var vars Path
+
+	if path[0] == '/' {
+		path = path[1:]
+		l -= 1
+	}
+
+	start, end := 0, 0
+
+	for pos, char := range path {
+
+		if char == '/' || pos == l-1 {
+			end = pos
+			if char != '/' {
+				end += 1
+			}
+			key = path[start:end]
+
+			next, found = node.children[key]
+			if !found {
+				next, found = node.children[any]
+				if !found {
+					return nil, nil
+				}
+				if next.paramRe != nil && !next.paramRe.MatchString(key) {
+					return nil, nil
+				}
+				vars = append(vars, PathVar{next.paramName, key})
+			}
+			start = pos + 1
+			node = next
+		}
+	}
+	return node.handlers, vars
+}
+
+// paths derived from the endpoints, with parameters filled in, parts
+// dropped and added, and a trailing slash
+func lookupPaths(endpoints []*endpoint) []string {
+	var paths []string
+	for _, ep := range endpoints {
+		parts := split(ep.path)
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") {
+				parts[i] = "42"
+			}
+		}
+		for n := 0; n <= len(parts); n++ {
+			p := "/" + strings.Join(parts[:n], "/")
+			paths = append(paths, p, p+"/", p+"//", p+"/extra", p+"/42")
+		}
+	}
+	return paths
+}
+
+func TestRadixMatchesTrie(t *testing.T) {
+	for _, endpoints := range [][]*endpoint{githubAPI, simpleAPI} {
+		r := NewRouter("")
+		for _, ep := range endpoints {
+			r.Route(ep.method, ep.path, ep.handler)
+		}
+		for _, path := range lookupPaths(endpoints) {
+			want, wantVars := trieGet(r.root.Load(), path)
+			got, gotVars := r.get(path, nil)
+			if want == nil {
+				gotVars, wantVars = nil, nil
+			}
+			same := len(want) == len(got) && (want == nil) == (got == nil)
+			for method, route := range want {
+				same = same && got[method] != nil && got[method].route == route
+			}
+			if !same || len(wantVars) != len(gotVars) || len(wantVars) > 0 && !reflect.DeepEqual(wantVars, gotVars) {
+				t.Errorf("%v: expected %v %v, got %v %v", path, want, wantVars, got, gotVars)
+			}
+		}
+	}
+}
+
+func TestServeMuxPatterns(t *testing.T) {
+	var got Path
+	var value string
+	r := NewRouter("")
+	r.Handle("GET /items/{id}", func(e *Env) {
+		got, value = append(Path{}, e.Path...), e.R.PathValue("id")
+	})
+	r.Handle("/files/{path...}", func(e *Env) {
+		got, value = append(Path{}, e.Path...), e.R.PathValue("path")
+	})
+	r.Handle("GET /{$}", func(e *Env) { got, value = nil, "root" })
+	// a trailing slash matches the subtree
+	r.Handle("GET /static/", func(e *Env) {
+		got, value = append(Path{}, e.Path...), e.R.PathValue("path")
+	})
+	r.Get("/users/:name", func(e *Env) {
+		got, value = append(Path{}, e.Path...), e.R.PathValue("name")
+	})
+	// paths that dead-end below the wildcard fall back to it
+	r.Get("/files/static/x", func(e *Env) { got, value = nil, "x" })
+	r.Get("/files/deep/{id}/y", func(e *Env) { got, value = nil, "y" })
+
+	cases := []struct {
+		method, path string
+		status       int
+		vars         Path
+		value        string
+	}{
+		{"GET", "/items/7", 200, Path{{"id", "7"}}, "7"},
+		{"POST", "/items/7", 405, nil, ""},
+		{"PUT", "/files/a/b/c.txt", 200, Path{{"path", "a/b/c.txt"}}, "a/b/c.txt"},
+		{"GET", "/files/", 200, Path{{"path", ""}}, ""},
+		{"GET", "/files/static/x", 200, nil, "x"},
+		{"GET", "/files/static/y", 200, Path{{"path", "static/y"}}, "static/y"},
+		{"GET", "/files/static", 200, Path{{"path", "static"}}, "static"},
+		{"GET", "/files/deep/7/z", 200, Path{{"path", "deep/7/z"}}, "deep/7/z"},
+		{"POST", "/files/static/x", 405, nil, ""},
+		{"GET", "/", 200, nil, "root"},
+		{"GET", "/static/css/a.css", 200, Path{{"path", "css/a.css"}}, "css/a.css"},
+		{"GET", "/static/", 200, Path{{"path", ""}}, ""},
+		// values of r2 patterns are only on Env.Path
+		{"GET", "/users/ann", 200, Path{{"name", "ann"}}, ""},
+	}
+	for _, c := range cases {
+		got, value = nil, ""
+		w := serve(r, c.method, c.path)
+		if w.Code != c.status || !reflect.DeepEqual(got, c.vars) || value != c.value {
+			t.Errorf("%v %v: expected %v %v %q, got %v %v %q", c.method, c.path, c.status, c.vars, c.value, w.Code, got, value)
+		}
+	}
+
+	if err := r.Add("GET", "/files/{rest...}/more", f1); err == nil {
+		t.Error("expected error for wildcard before end of path")
+	}
+	if err := r.Add("GET", "/files/{other...}", f1); err == nil {
+		t.Error("expected conflict between wildcard names")
+	}
+	if err := r.Remove("ANY", "/files/{path...}"); err == nil {
+		t.Error("expected missing method")
+	}
+	if err := r.Remove("?", "/files/{path...}"); err != nil {
+		t.Error(err)
+	}
+}
+
+var matched *Route
+
+func f4(e *Env) {
+	matched = e.Route
+}
+
+func TestRouteMeta(t *testing.T) {
+	var route *Route
+	var scope interface{}
+	r := NewRouter("")
+	h := func(e *Env) { route, scope = e.Route, e.Meta("scope") }
+	r.Get("/repos/:owner", h, Name("repo"), Tags("repos"), Meta("scope", "read"))
+	r.Delete("/repos/:owner", h, Name("deleteRepo"), Tags("repos", "admin"), Meta("scope", "admin"))
+	r.Get("/health", h)
+	r.Route("?", "/:anything", f4)
+
+	serve(r, "DELETE", "/repos/ann")
+	if route == nil || route.Name != "deleteRepo" || route.Pattern != "/repos/:owner" || scope != "admin" {
+		t.Errorf("unexpected route %+v %v", route, scope)
+	}
+	serve(r, "GET", "/health")
+	if route == nil || route.Name != "" || scope != nil {
+		t.Errorf("unexpected route %+v %v", route, scope)
+	}
+	serve(r, "PATCH", "/any")
+	if matched == nil || matched.Method != "?" || matched.Pattern != "/:anything" || matched.HandlerName != "f4" {
+		t.Errorf("unexpected fallback route %+v", matched)
+	}
+	if named := r.Named("repo"); named == nil || named.Method != "GET" {
+		t.Errorf("unexpected named route %+v", named)
+	}
+	if tagged := r.Tagged("repos"); len(tagged) != 2 || len(r.Tagged("admin")) != 1 {
+		t.Errorf("unexpected tagged routes %v", tagged)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var calls []string
+	hook := func(name string) func(*Env) {
+		return func(e *Env) {
+			s := name
+			if e.Route != nil {
+				s += " " + e.Route.Pattern
+			}
+			calls = append(calls, s)
+		}
+	}
+	r := NewRouter("")
+	r.Hooks = Hooks{
+		Request:          hook("request"),
+		NotFound:         hook("not found"),
+		MethodNotAllowed: hook("method not allowed"),
+		Preflight:        hook("preflight"),
+		Matched:          hook("matched"),
+		HandlerStart:     hook("start"),
+		HandlerEnd:       hook("end"),
+	}
+	r.Get("/a/:id", func(e *Env) { calls = append(calls, "handler "+e.Path.Get("id")) })
+	serve(r, "GET", "/a/1")
+	serve(r, "POST", "/a/1")
+	serve(r, "GET", "/b")
+	r.CORS = &CORS{Origins: []string{"*"}}
+	request(r, "OPTIONS", "/a/1", map[string]string{"Origin": "https://a.com", "Access-Control-Request-Method": "GET"})
+	want := []string{
+		"request", "matched /a/:id", "start /a/:id", "handler 1", "end /a/:id",
+		"request", "method not allowed",
+		"request", "not found",
+		"request", "preflight",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected %q, got %q", want, calls)
+	}
+}
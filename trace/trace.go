@@ -0,0 +1,231 @@
+// Package trace records a span for each request dispatched by an r2
+// Router, named after the matched route pattern and linked to callers
+// through W3C traceparent headers.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aver-d/r2"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+type Span struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// zero for a span with no caller
+	ParentID SpanID
+	Sampled  bool
+	// the incoming tracestate header, passed on unchanged
+	State string
+
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Events     []Event
+}
+
+type Event struct {
+	Name string
+	Time time.Time
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.Attributes[key] = value
+}
+
+func (s *Span) AddEvent(name string) {
+	s.Events = append(s.Events, Event{name, time.Now()})
+}
+
+// TraceParent formats the span as a traceparent header value, for calls
+// made while handling the request.
+func (s *Span) TraceParent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%v-%v-%v", s.TraceID, s.SpanID, flags)
+}
+
+// Exporter receives spans as they end.
+type Exporter interface {
+	Export(*Span)
+}
+
+// Memory is an Exporter keeping spans in memory, for tests.
+type Memory struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (m *Memory) Export(s *Span) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, s)
+}
+
+// Spans returns the spans exported so far.
+func (m *Memory) Spans() []*Span {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Span(nil), m.spans...)
+}
+
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = nil
+}
+
+type Tracer struct {
+	Exporter Exporter
+}
+
+func New(e Exporter) *Tracer {
+	return &Tracer{e}
+}
+
+type spanKey struct{}
+
+// FromEnv returns the span of a request, or nil if it isn't traced.
+func FromEnv(env *r2.Env) *Span {
+	s, _ := env.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Inject sets the headers of an outgoing request so that its spans become
+// children of the span of env.
+func Inject(env *r2.Env, h http.Header) {
+	s := FromEnv(env)
+	if s == nil {
+		return
+	}
+	h.Set("traceparent", s.TraceParent())
+	if s.State != "" {
+		h.Set("tracestate", s.State)
+	}
+}
+
+// Install sets the router's hooks to trace every request, replacing any
+// hooks already set.
+func (t *Tracer) Install(r *r2.Router) {
+	r.Hooks = t.Hooks()
+}
+
+func (t *Tracer) Hooks() r2.Hooks {
+	return r2.Hooks{
+		Request:          t.start,
+		Matched:          t.matched,
+		HandlerStart:     func(env *r2.Env) { event(env, "handler.start") },
+		HandlerEnd:       t.end,
+		NotFound:         t.unmatched(http.StatusNotFound),
+		MethodNotAllowed: t.unmatched(http.StatusMethodNotAllowed),
+		Preflight:        t.unmatched(http.StatusNoContent),
+	}
+}
+
+func (t *Tracer) start(env *r2.Env) {
+	s := &Span{
+		Name:       "HTTP " + env.R.Method,
+		Start:      time.Now(),
+		Sampled:    true,
+		Attributes: map[string]string{"http.method": env.R.Method, "http.target": env.R.URL.Path},
+	}
+	if parent, ok := parseTraceParent(env.R.Header.Get("traceparent")); ok {
+		s.TraceID, s.ParentID, s.Sampled = parent.TraceID, parent.SpanID, parent.Sampled
+		s.State = env.R.Header.Get("tracestate")
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	rand.Read(s.SpanID[:])
+	env.Set(spanKey{}, s)
+}
+
+func (t *Tracer) matched(env *r2.Env) {
+	s := FromEnv(env)
+	if s == nil {
+		return
+	}
+	s.Name = env.R.Method + " " + env.Route.Pattern
+	s.SetAttribute("http.route", env.Route.Pattern)
+	for _, v := range env.Path {
+		s.SetAttribute("path."+v.Name, v.Value)
+	}
+}
+
+func event(env *r2.Env, name string) {
+	if s := FromEnv(env); s != nil {
+		s.AddEvent(name)
+	}
+}
+
+func (t *Tracer) end(env *r2.Env) {
+	s := FromEnv(env)
+	if s == nil {
+		return
+	}
+	s.AddEvent("handler.end")
+	status := env.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	s.SetAttribute("http.status_code", strconv.Itoa(status))
+	t.finish(s)
+}
+
+func (t *Tracer) finish(s *Span) {
+	s.End = time.Now()
+	if s.Sampled && t.Exporter != nil {
+		t.Exporter.Export(s)
+	}
+}
+
+// unmatched ends the span of a request no route handles, with the status
+// the router answers it with.
+func (t *Tracer) unmatched(status int) func(*r2.Env) {
+	return func(env *r2.Env) {
+		s := FromEnv(env)
+		if s == nil {
+			return
+		}
+		s.SetAttribute("http.status_code", strconv.Itoa(status))
+		t.finish(s)
+	}
+}
+
+// parseTraceParent parses a version 00 traceparent header.
+func parseTraceParent(h string) (*Span, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil, false
+	}
+	s := &Span{}
+	if _, err := hex.Decode(s.TraceID[:], []byte(parts[1])); err != nil || s.TraceID == (TraceID{}) {
+		return nil, false
+	}
+	if _, err := hex.Decode(s.SpanID[:], []byte(parts[2])); err != nil || s.SpanID == (SpanID{}) {
+		return nil, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil, false
+	}
+	s.Sampled = flags[0]&1 == 1
+	return s, true
+}
@@ -0,0 +1,88 @@
+package trace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aver-d/r2"
+)
+
+func TestTrace(t *testing.T) {
+	mem := &Memory{}
+	r := r2.NewRouter("")
+	New(mem).Install(r)
+
+	var outgoing http.Header
+	r.Get("/repos/:owner/:repo", func(e *r2.Env) {
+		outgoing = http.Header{}
+		Inject(e, outgoing)
+		e.Text(201, "ok")
+	})
+
+	req := httptest.NewRequest("GET", "/repos/ann/r2", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nothing", nil))
+
+	spans := mem.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %v", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "GET /repos/:owner/:repo" || s.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		s.ParentID.String() != "00f067aa0ba902b7" || !s.Sampled || s.End.IsZero() {
+		t.Errorf("unexpected span %+v", s)
+	}
+	for key, want := range map[string]string{
+		"http.route": "/repos/:owner/:repo", "path.owner": "ann", "path.repo": "r2", "http.status_code": "201",
+	} {
+		if s.Attributes[key] != want {
+			t.Errorf("%v expected %v, got %v", key, want, s.Attributes[key])
+		}
+	}
+	if len(s.Events) != 2 || s.Events[0].Name != "handler.start" || s.Events[1].Name != "handler.end" {
+		t.Errorf("unexpected events %v", s.Events)
+	}
+	if outgoing.Get("traceparent") != s.TraceParent() || outgoing.Get("tracestate") != "vendor=1" {
+		t.Errorf("unexpected propagation %v", outgoing)
+	}
+
+	s = spans[1]
+	if s.Name != "HTTP GET" || s.Attributes["http.status_code"] != "404" || s.ParentID != (SpanID{}) {
+		t.Errorf("unexpected span %+v", s)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	for h, ok := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00": true,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": false,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7":    false,
+		"": false,
+	} {
+		if _, got := parseTraceParent(h); got != ok {
+			t.Errorf("%q expected %v", h, ok)
+		}
+	}
+}
+
+func TestTracePreflight(t *testing.T) {
+	mem := &Memory{}
+	r := r2.NewRouter("")
+	r.CORS = &r2.CORS{Origins: []string{"*"}}
+	New(mem).Install(r)
+	r.Get("/items", func(e *r2.Env) {})
+
+	req := httptest.NewRequest("OPTIONS", "/items", nil)
+	req.Header.Set("Origin", "https://a.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := mem.Spans()
+	if len(spans) != 1 || spans[0].End.IsZero() || spans[0].Attributes["http.status_code"] != "204" {
+		t.Errorf("preflight span not ended: %+v", spans)
+	}
+}
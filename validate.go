@@ -0,0 +1,260 @@
+package r2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Spec declares the query parameters, headers and JSON body fields a route
+// expects. Requests that don't conform are answered with 400 Bad Request
+// before the handler runs.
+type Spec struct {
+	Query  []Field
+	Header []Field
+	// fields of a JSON object body
+	Body []Field
+}
+
+type Field struct {
+	Name string
+	// one of "string" (the default), "int", "float", "bool", "object" or "array".
+	// Body fields are JSON values, query and header fields are converted from text.
+	Type     string
+	Required bool
+	// regex a string value must match, anchored as for path parameters
+	Pattern string
+	// allowed values of a string
+	Enum []string
+
+	re *regexp.Regexp
+}
+
+// Input holds the converted values of the fields present in a request.
+type Input struct {
+	Query  map[string]interface{}
+	Header map[string]interface{}
+	Body   map[string]interface{}
+}
+
+// ValidationError lists every way a request failed its route's Spec.
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return strings.Join(v, "; ")
+}
+
+// Validate attaches spec to a route.
+func Validate(spec Spec) Option {
+	spec.Query = compileFields(spec.Query)
+	spec.Header = compileFields(spec.Header)
+	spec.Body = compileFields(spec.Body)
+	return func(route *Route) {
+		route.spec = &spec
+	}
+}
+
+// compileFields copies fields, compiling their patterns.
+func compileFields(fields []Field) []Field {
+	compiled := make([]Field, len(fields))
+	for i, field := range fields {
+		if field.Pattern != "" {
+			re, err := compileRe(field.Pattern)
+			if err != nil {
+				log.Fatal(err)
+			}
+			field.re = re
+		}
+		compiled[i] = field
+	}
+	return compiled
+}
+
+// wrap checks requests before passing them to next, answering those that
+// fail with 400 Bad Request.
+func (s *Spec) wrap(next Handler) Handler {
+	return func(env *Env) {
+		if limit := env.router.MaxBodySize; limit > 0 && len(s.Body) > 0 && env.R.Body != nil {
+			env.R.Body = http.MaxBytesReader(env.W, env.R.Body, limit)
+		}
+		input, err := s.validate(env.R)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			env.Error(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if err != nil {
+			env.Error(http.StatusBadRequest, err)
+			return
+		}
+		env.Input = input
+		next(env)
+	}
+}
+
+func (s *Spec) validate(req *http.Request) (*Input, error) {
+	in := &Input{}
+	var errs ValidationError
+
+	if len(s.Query) > 0 {
+		query := req.URL.Query()
+		in.Query, errs = checkText("query", s.Query, func(name string) []string { return query[name] }, errs)
+	}
+	if len(s.Header) > 0 {
+		in.Header, errs = checkText("header", s.Header, func(name string) []string { return req.Header.Values(name) }, errs)
+	}
+	if len(s.Body) > 0 {
+		var err error
+		in.Body, errs, err = s.checkBody(req, errs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return in, nil
+}
+
+func checkText(where string, fields []Field, values func(string) []string, errs ValidationError) (map[string]interface{}, ValidationError) {
+	found := map[string]interface{}{}
+	for _, field := range fields {
+		vals := values(field.Name)
+		if len(vals) == 0 {
+			if field.Required {
+				errs = append(errs, where+" "+field.Name+": required")
+			}
+			continue
+		}
+		val, msg := field.convert(vals[0])
+		if msg != "" {
+			errs = append(errs, where+" "+field.Name+": "+msg)
+			continue
+		}
+		found[field.Name] = val
+	}
+	return found, errs
+}
+
+func (f *Field) convert(s string) (interface{}, string) {
+	switch f.Type {
+	case "int":
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, "must be an integer"
+		}
+		return i, ""
+	case "float":
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, "must be a number"
+		}
+		return x, ""
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, "must be a boolean"
+		}
+		return b, ""
+	}
+	return s, f.checkString(s)
+}
+
+func (f *Field) checkString(s string) string {
+	if f.re != nil && !f.re.MatchString(s) {
+		return "must match " + f.re.String()
+	}
+	if len(f.Enum) > 0 {
+		for _, e := range f.Enum {
+			if s == e {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(f.Enum, ", ")
+	}
+	return ""
+}
+
+// checkBody returns an error, rather than a violation, for a body over
+// the router's MaxBodySize.
+func (s *Spec) checkBody(req *http.Request, errs ValidationError) (map[string]interface{}, ValidationError, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errs, err
+		}
+		if err != nil {
+			return nil, append(errs, "body: "+err.Error()), nil
+		}
+		// let the handler read the body again
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	obj := map[string]interface{}{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return nil, append(errs, "body: must be a JSON object"), nil
+		}
+	}
+	found := map[string]interface{}{}
+	for _, field := range s.Body {
+		val, present := obj[field.Name]
+		if !present || val == nil {
+			if field.Required {
+				errs = append(errs, "body "+field.Name+": required")
+			}
+			continue
+		}
+		val, msg := field.check(val)
+		if msg != "" {
+			errs = append(errs, "body "+field.Name+": "+msg)
+			continue
+		}
+		found[field.Name] = val
+	}
+	return found, errs, nil
+}
+
+// check a decoded JSON value
+func (f *Field) check(val interface{}) (interface{}, string) {
+	switch f.Type {
+	case "int":
+		x, ok := val.(float64)
+		if !ok || x != math.Trunc(x) {
+			return nil, "must be an integer"
+		}
+		return int(x), ""
+	case "float":
+		if _, ok := val.(float64); !ok {
+			return nil, "must be a number"
+		}
+	case "bool":
+		if _, ok := val.(bool); !ok {
+			return nil, "must be a boolean"
+		}
+	case "object":
+		if _, ok := val.(map[string]interface{}); !ok {
+			return nil, "must be an object"
+		}
+	case "array":
+		if _, ok := val.([]interface{}); !ok {
+			return nil, "must be an array"
+		}
+	default:
+		s, ok := val.(string)
+		if !ok {
+			return nil, "must be a string"
+		}
+		return s, f.checkString(s)
+	}
+	return val, ""
+}
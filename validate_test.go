@@ -0,0 +1,86 @@
+package r2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var searchSpec = Spec{
+	Query: []Field{
+		{Name: "q", Required: true},
+		{Name: "limit", Type: "int"},
+		{Name: "sort", Enum: []string{"asc", "desc"}},
+	},
+	Header: []Field{{Name: "X-Tenant", Required: true, Pattern: `[a-z]+`}},
+	Body: []Field{
+		{Name: "count", Type: "int", Required: true},
+		{Name: "tags", Type: "array"},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	var input *Input
+	r := NewRouter("")
+	r.Post("/search", func(e *Env) { input = e.Input }, Validate(searchSpec))
+
+	req := httptest.NewRequest("POST", "/search?q=go&limit=5", strings.NewReader(`{"count": 2, "tags": []}`))
+	req.Header.Set("X-Tenant", "acme")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || input == nil {
+		t.Fatalf("expected handler to run, got %v %v", w.Code, w.Body)
+	}
+	if input.Query["limit"] != 5 || input.Query["q"] != "go" || input.Body["count"] != 2 || input.Header["X-Tenant"] != "acme" {
+		t.Errorf("unexpected input %+v", input)
+	}
+
+	input = nil
+	req = httptest.NewRequest("POST", "/search?limit=x&sort=up", strings.NewReader(`{"count": 1.5, "tags": "a"}`))
+	req.Header.Set("X-Tenant", "ACME")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || input != nil {
+		t.Fatalf("expected 400, got %v", w.Code)
+	}
+	var res struct{ Errors []string }
+	json.NewDecoder(w.Body).Decode(&res)
+	expected := []string{
+		"query q: required",
+		"query limit: must be an integer",
+		"query sort: must be one of asc, desc",
+		"header X-Tenant: must match ^[a-z]+$",
+		"body count: must be an integer",
+		"body tags: must be an array",
+	}
+	if !reflect.DeepEqual(res.Errors, expected) {
+		t.Errorf("expected %q, got %q", expected, res.Errors)
+	}
+}
+
+func TestValidateBodyLimit(t *testing.T) {
+	ran := false
+	r := NewRouter("")
+	r.MaxBodySize = 16
+	r.Post("/count", func(e *Env) { ran = true }, Validate(Spec{Body: []Field{{Name: "count", Type: "int"}}}))
+
+	body := `{"count": 1, "padding": "` + strings.Repeat("x", 100*1024) + `"}`
+	w := serveBody(r, "/count", body)
+	if w.Code != http.StatusRequestEntityTooLarge || ran {
+		t.Errorf("expected 413, got %v", w.Code)
+	}
+	if w := serveBody(r, "/count", `{"count":1}`); w.Code != http.StatusOK || !ran {
+		t.Errorf("expected 200, got %v", w.Code)
+	}
+}
+
+func serveBody(r *Router, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+	return w
+}